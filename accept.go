@@ -0,0 +1,177 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+const decisionsFile = "decisions.jsonl"
+
+type Decision struct {
+    Action   string    `json:"action"`
+    File     string    `json:"file"`
+    Hash     string    `json:"hash"`
+    Previous string    `json:"previous,omitempty"`
+    By       string    `json:"by"`
+    At       time.Time `json:"at"`
+    Reason   string    `json:"reason,omitempty"`
+}
+
+func currentUser() string {
+    if u, err := user.Current(); err == nil && u.Username != "" {
+        return u.Username
+    }
+    if name := os.Getenv("USER"); name != "" {
+        return name
+    }
+    return "unknown"
+}
+
+func (e *ManifestEntry) isRejected(hash string) bool {
+    for _, d := range e.Rejected {
+        if d.Hash == hash {
+            return true
+        }
+    }
+    return false
+}
+
+func latestObservedObject(ws *WatchSet, filename string) (string, error) {
+    observations, err := fileObservations(ws, filename)
+    if err != nil {
+        return "", err
+    }
+    for i := len(observations) - 1; i >= 0; i-- {
+        if observations[i].Object != "" {
+            return observations[i].Object, nil
+        }
+    }
+    return "", fmt.Errorf("no observed version of %s to decide on", filename)
+}
+
+func resolveDecisionHash(ws *WatchSet, filename, hash string) (string, error) {
+    if hash == "" {
+        return latestObservedObject(ws, filename)
+    }
+    hash = strings.ToLower(hash)
+    if len(hash) == 64 {
+        return hash, nil
+    }
+    observations, err := fileObservations(ws, filename)
+    if err != nil {
+        return "", err
+    }
+    entry, err := resolveVersion(ws, observations, hash)
+    if err != nil {
+        return "", err
+    }
+    return entry.Object, nil
+}
+
+func observedCommitOf(ws *WatchSet, filename, hash string) string {
+    observations, _ := fileObservations(ws, filename)
+    for i := len(observations) - 1; i >= 0; i-- {
+        if observations[i].Object == hash {
+            return observations[i].Commit
+        }
+    }
+    return ""
+}
+
+func acceptVersion(ws *WatchSet, filename, hash, by, reason string) (*Decision, error) {
+    store := openStore(ws)
+    data, err := store.get(hash)
+    if err != nil {
+        return nil, fmt.Errorf("version %s is not in the object store: %v", hash, err)
+    }
+
+    manifest, err := loadManifest(ws)
+    if err != nil {
+        return nil, err
+    }
+
+    decision := &Decision{Action: "accept", File: filename, Hash: hash, By: by, At: time.Now().UTC(), Reason: reason}
+    entry := manifest.Files[filename]
+    if entry == nil {
+        entry = &ManifestEntry{SourceURL: ws.source().Location(filename)}
+        manifest.Files[filename] = entry
+    } else {
+        decision.Previous = entry.SHA256
+    }
+    entry.SHA256 = hash
+    entry.Size = int64(len(data))
+    entry.Commit = observedCommitOf(ws, filename, hash)
+    entry.FetchedAt = decision.At
+    entry.Accepted = decision
+    entry.Rejected = nil
+
+    if err := os.WriteFile(filepath.Join(ws.Dir, filename), data, 0644); err != nil {
+        return nil, fmt.Errorf("updating local copy: %v", err)
+    }
+    if err := saveManifest(ws, manifest); err != nil {
+        return nil, err
+    }
+    return decision, recordDecision(ws, decision)
+}
+
+func rejectVersion(ws *WatchSet, filename, hash, by, reason string) (*Decision, error) {
+    manifest, err := loadManifest(ws)
+    if err != nil {
+        return nil, err
+    }
+    entry := manifest.Files[filename]
+    if entry == nil {
+        return nil, fmt.Errorf("%s has no baseline in the manifest; accept a version first", filename)
+    }
+    if entry.SHA256 == hash {
+        return nil, fmt.Errorf("%s is the current baseline of %s", hash, filename)
+    }
+
+    decision := &Decision{Action: "reject", File: filename, Hash: hash, Previous: entry.SHA256, By: by, At: time.Now().UTC(), Reason: reason}
+    if !entry.isRejected(hash) {
+        entry.Rejected = append(entry.Rejected, *decision)
+    }
+    if err := saveManifest(ws, manifest); err != nil {
+        return nil, err
+    }
+    return decision, recordDecision(ws, decision)
+}
+
+func recordDecision(ws *WatchSet, decision *Decision) error {
+    if err := os.MkdirAll(ws.StateDir, 0755); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(filepath.Join(ws.StateDir, decisionsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    line, err := json.Marshal(decision)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(append(line, '\n')); err != nil {
+        return err
+    }
+
+    ts := decision.At.Local().Format("Jan 02, 2006 - 03:04PM")
+    verb := "Accepted"
+    if decision.Action == "reject" {
+        verb = "Rejected"
+    }
+    text := fmt.Sprintf("[%s] %s: %s version %s by %s", ts, decision.File, verb, decision.Hash, decision.By)
+    if decision.Previous != "" {
+        text += fmt.Sprintf(" (baseline was %s)", decision.Previous)
+    }
+    if decision.Reason != "" {
+        text += ": " + decision.Reason
+    }
+    writeOutputs(ws, ts, []shiftEntry{{File: decision.File, Kind: decision.Action, Text: text + "\n"}})
+    return nil
+}
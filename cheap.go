@@ -0,0 +1,200 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "sync"
+    "time"
+)
+
+const httpMetaFile = "http_meta.json"
+
+// httpMeta is what the last full download of a file returned, kept so later
+// cycles can ask the server whether anything changed instead of downloading
+// the body again.
+type httpMeta struct {
+    ETag          string    `json:"etag,omitempty"`
+    LastModified  string    `json:"last_modified,omitempty"`
+    ContentLength int64     `json:"content_length"`
+    Object        string    `json:"object"`
+    CheckedAt     time.Time `json:"checked_at"`
+    VerifiedAt    time.Time `json:"verified_at"`
+}
+
+type cheapCheck struct {
+    mode         string
+    fullInterval time.Duration
+    store        *objectStore
+
+    mu    sync.Mutex
+    files map[string]*httpMeta
+}
+
+func httpMetaPath(ws *WatchSet) string {
+    return filepath.Join(ws.StateDir, httpMetaFile)
+}
+
+func loadCheapCheck(ws *WatchSet) (*cheapCheck, error) {
+    c := &cheapCheck{mode: ws.Fetch.CheapCheck, fullInterval: time.Duration(*ws.Fetch.FullInterval), store: openStore(ws), files: map[string]*httpMeta{}}
+    data, err := os.ReadFile(httpMetaPath(ws))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return c, nil
+        }
+        return nil, err
+    }
+    if err := json.Unmarshal(data, &c.files); err != nil {
+        return nil, fmt.Errorf("%s: %v", httpMetaPath(ws), err)
+    }
+    return c, nil
+}
+
+func (c *cheapCheck) save(ws *WatchSet) error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    data, err := json.MarshalIndent(c.files, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(httpMetaPath(ws), append(data, '\n'))
+}
+
+// revalidatable returns the recorded metadata for filename when a cheap check
+// may stand in for a download: the server gave a validator last time, the
+// content is in the object store, and full verification is not yet due.
+func (c *cheapCheck) revalidatable(filename string) *httpMeta {
+    if c == nil {
+        return nil
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    meta := c.files[filename]
+    if meta == nil || (meta.ETag == "" && meta.LastModified == "") || !c.store.has(meta.Object) {
+        return nil
+    }
+    if c.fullInterval > 0 && time.Since(meta.VerifiedAt) >= c.fullInterval {
+        return nil
+    }
+    copied := *meta
+    return &copied
+}
+
+func (c *cheapCheck) touch(filename string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if meta := c.files[filename]; meta != nil {
+        meta.CheckedAt = time.Now().UTC()
+    }
+}
+
+// record stores the metadata of a full download. It reports whether the
+// server sent the same validators as before for different content, which
+// means cheap checks against it cannot be trusted.
+func (c *cheapCheck) record(filename string, header http.Header, body []byte) bool {
+    if c == nil {
+        return false
+    }
+    now := time.Now().UTC()
+    meta := &httpMeta{
+        ETag:          header.Get("ETag"),
+        LastModified:  header.Get("Last-Modified"),
+        ContentLength: int64(len(body)),
+        Object:        sha256Hex(body),
+        CheckedAt:     now,
+        VerifiedAt:    now,
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    prev := c.files[filename]
+    c.files[filename] = meta
+    return prev != nil && prev.Object != meta.Object && prev.sameValidators(header)
+}
+
+func (m *httpMeta) sameValidators(header http.Header) bool {
+    etag, lastModified := header.Get("ETag"), header.Get("Last-Modified")
+    matched := false
+    if m.ETag != "" && etag != "" {
+        if m.ETag != etag {
+            return false
+        }
+        matched = true
+    }
+    if m.LastModified != "" && lastModified != "" {
+        if m.LastModified != lastModified {
+            return false
+        }
+        matched = true
+    }
+    return matched
+}
+
+// revalidate asks the server whether filename still matches meta, with a
+// HEAD or a conditional GET depending on the mode. It returns nil without an
+// error when the answer is inconclusive and a full download is needed.
+func (s *httpSource) revalidate(ctx context.Context, filename string, meta *httpMeta) (*remoteFile, error) {
+    sourceURL := s.Location(filename)
+    method := "GET"
+    if s.cheap.mode == "head" {
+        method = "HEAD"
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, sourceURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    s.profile.apply(req)
+    req.Header.Del("If-None-Match")
+    req.Header.Del("If-Modified-Since")
+    if method == "GET" {
+        if meta.ETag != "" {
+            req.Header.Set("If-None-Match", meta.ETag)
+        }
+        if meta.LastModified != "" {
+            req.Header.Set("If-Modified-Since", meta.LastModified)
+        }
+    }
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    remote := &remoteFile{URL: sourceURL, StatusCode: resp.StatusCode, Header: resp.Header}
+    switch {
+    case method == "GET" && resp.StatusCode == http.StatusOK:
+        // The server ignored the validators and sent the body anyway.
+        remote.Body, err = s.readBody(resp)
+        if err != nil {
+            return nil, err
+        }
+        remote.StaleValidators = s.cheap.record(filename, resp.Header, remote.Body)
+        return remote, nil
+    case method == "GET" && resp.StatusCode == http.StatusNotModified:
+    case method == "HEAD" && resp.StatusCode == http.StatusOK:
+        if !meta.sameValidators(resp.Header) {
+            return nil, nil
+        }
+        if n, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil && n != meta.ContentLength && resp.Header.Get("Content-Encoding") == "" {
+            return nil, nil
+        }
+    default:
+        return remote, nil
+    }
+
+    body, err := s.cheap.store.get(meta.Object)
+    if err != nil {
+        return nil, nil
+    }
+    s.cheap.touch(filename)
+    remote.StatusCode = http.StatusOK
+    remote.Body = body
+    remote.Revalidated = true
+    return remote, nil
+}
@@ -0,0 +1,973 @@
+package main
+
+import (
+    "context"
+    "crypto/ed25519"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const usageText = `Usage: integrity <command> [flags]
+
+Common flags: --config FILE, --dir DIR, --set NAME
+
+Commands:
+  baseline     fetch remote files and save them as the local baseline
+  check        run an integrity cycle now (--once to exit after it)
+  watch        run integrity cycles forever, every --interval minutes
+  verify       check local files against the baseline manifest (and --expect unified hash)
+  history      print the shift log, or the observed versions of one file
+  show         print a file as observed at --at TIME
+  diff         diff a file between two observed times (or object hashes)
+  accept       promote an observed remote version of a file to the new baseline
+  reject       acknowledge an observed remote version without adopting it
+  prove        emit a Merkle inclusion proof for one file (last cycle, or --local)
+  verify-proof check an inclusion proof against a root, optionally against a --file
+  verify-log   check the hash chain (and signatures) of the shift log
+  keygen       generate the Ed25519 key used to sign cycle receipts
+  verify-receipt verify signed cycle receipts offline with --pubkey
+
+Environment:
+  INTEGRITY_CONFIG     config file (default: ./integrity.yaml if present)
+  INTEGRITY_DIR        directory to scan without a config file (default: working directory)
+  INTEGRITY_INTERVAL   minutes between cycles (default 60)
+  INTEGRITY_BASELINE   y/n, fetch baselines before watching when no command is given
+
+With no command and an interactive terminal, the original prompts are used.
+`
+
+func run(ctx context.Context, args []string) int {
+    if len(args) == 0 {
+        return runDefault(ctx)
+    }
+
+    cmd, rest := args[0], args[1:]
+    switch cmd {
+    case "baseline":
+        return cmdBaseline(ctx, rest)
+    case "check":
+        return cmdCheck(ctx, rest)
+    case "watch":
+        return cmdWatch(ctx, rest)
+    case "verify":
+        return cmdVerify(rest)
+    case "history":
+        return cmdHistory(rest)
+    case "show":
+        return cmdShow(rest)
+    case "diff":
+        return cmdDiff(rest)
+    case "accept":
+        return cmdDecide("accept", rest)
+    case "reject":
+        return cmdDecide("reject", rest)
+    case "prove":
+        return cmdProve(rest)
+    case "verify-proof":
+        return cmdVerifyProof(rest)
+    case "verify-log":
+        return cmdVerifyLog(rest)
+    case "keygen":
+        return cmdKeygen(rest)
+    case "verify-receipt":
+        return cmdVerifyReceipt(rest)
+    case "help", "-h", "-help", "--help":
+        fmt.Print(usageText)
+        return 0
+    default:
+        fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", cmd, usageText)
+        return 2
+    }
+}
+
+func runDefault(ctx context.Context) int {
+    cfg, err := loadCommandConfig("", "")
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    var baselineMode bool
+    if v, ok := os.LookupEnv("INTEGRITY_BASELINE"); ok {
+        baselineMode = strings.ToLower(strings.TrimSpace(v)) == "y"
+    } else if stdinIsTerminal() {
+        baselineMode = promptBaselineMode()
+    }
+
+    if baselineMode {
+        for _, ws := range cfg.WatchSets {
+            fetchBaselines(ctx, ws)
+        }
+    }
+
+    interval, ok := envInterval()
+    if !ok {
+        if stdinIsTerminal() {
+            interval = promptInterval()
+        } else {
+            interval = intervalOrDefault(0, cfg)
+        }
+    }
+
+    watchLoop(ctx, cfg.WatchSets, interval)
+    return 0
+}
+
+type commonFlags struct {
+    config *string
+    dir    *string
+    set    *string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *commonFlags) {
+    fs := flag.NewFlagSet(name, flag.ContinueOnError)
+    common := &commonFlags{
+        config: fs.String("config", "", "config file (env INTEGRITY_CONFIG, default: ./"+defaultConfigFile+" if present)"),
+        dir:    fs.String("dir", "", "directory to scan when no config file is used (env INTEGRITY_DIR)"),
+        set:    fs.String("set", "", "only operate on the named watch set"),
+    }
+    return fs, common
+}
+
+func (c *commonFlags) load() (*Config, []*WatchSet, error) {
+    cfg, err := loadCommandConfig(*c.config, *c.dir)
+    if err != nil {
+        return nil, nil, err
+    }
+    sets, err := cfg.selectSets(*c.set)
+    if err != nil {
+        return nil, nil, err
+    }
+    return cfg, sets, nil
+}
+
+func loadCommandConfig(configFlag, dirFlag string) (*Config, error) {
+    path := configFlag
+    if path == "" {
+        path = os.Getenv("INTEGRITY_CONFIG")
+    }
+    if path == "" {
+        if _, err := os.Stat(defaultConfigFile); err == nil {
+            path = defaultConfigFile
+        }
+    }
+
+    if path != "" {
+        if dirFlag != "" {
+            return nil, fmt.Errorf("--dir cannot be combined with a config file; set dir in %s instead", path)
+        }
+        return loadConfig(path)
+    }
+
+    runningDir, err := resolveDir(dirFlag)
+    if err != nil {
+        return nil, fmt.Errorf("Error getting running directory: %v", err)
+    }
+    cfg := defaultConfig(runningDir)
+    if err := cfg.validate(); err != nil {
+        return nil, err
+    }
+    return cfg, nil
+}
+
+func cmdBaseline(ctx context.Context, args []string) int {
+    fs, common := newFlagSet("baseline")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    _, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+    for _, ws := range sets {
+        fetchBaselines(ctx, ws)
+    }
+    return 0
+}
+
+func cmdCheck(ctx context.Context, args []string) int {
+    fs, common := newFlagSet("check")
+    once := fs.Bool("once", false, "run a single cycle and exit (status 1 if a new shift or new upstream file was logged, 2 if a cycle failed)")
+    interval := fs.Int("interval", 0, "minutes between cycles when not --once (env INTEGRITY_INTERVAL)")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    cfg, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    if *once {
+        shifts, failed := 0, false
+        for _, ws := range sets {
+            n, err := runCycle(ctx, ws)
+            if err != nil {
+                failed = true
+            }
+            shifts += n
+        }
+        switch {
+        case failed:
+            return 2
+        case shifts > 0:
+            return 1
+        }
+        return 0
+    }
+
+    watchLoop(ctx, sets, intervalOrDefault(*interval, cfg))
+    return 0
+}
+
+func cmdWatch(ctx context.Context, args []string) int {
+    fs, common := newFlagSet("watch")
+    interval := fs.Int("interval", 0, "minutes between cycles (env INTEGRITY_INTERVAL)")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    cfg, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    minutes := *interval
+    if minutes <= 0 {
+        var ok bool
+        if minutes, ok = envInterval(); !ok {
+            if cfg.Interval > 0 {
+                minutes = cfg.Interval
+            } else if stdinIsTerminal() {
+                minutes = promptInterval()
+            } else {
+                minutes = defaultMinutes
+            }
+        }
+    }
+
+    watchLoop(ctx, sets, minutes)
+    return 0
+}
+
+func cmdVerify(args []string) int {
+    fs, common := newFlagSet("verify")
+    expect := fs.String("expect", "", "expected unified hash (with or without 0x prefix)")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    _, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+    if *expect != "" && len(sets) > 1 {
+        fmt.Println("--expect needs a single watch set; use --set")
+        return 2
+    }
+
+    status := 0
+    for _, ws := range sets {
+        manifest, err := loadManifest(ws)
+        if err != nil {
+            fmt.Printf("%s: Error loading manifest: %v\n", ws.Name, err)
+            status = 1
+            continue
+        }
+        filenames, err := trackedFiles(ws, manifest)
+        if err != nil {
+            fmt.Printf("%s: Error reading directory: %v\n", ws.Name, err)
+            status = 1
+            continue
+        }
+        if len(manifest.Files) == 0 {
+            fmt.Printf("%s: No baseline manifest at %s; only hashing local files\n", ws.Name, manifestPath(ws))
+        }
+
+        var leaves []merkleLeaf
+        for _, filename := range filenames {
+            entry := manifest.Files[filename]
+            h, err := fileHash(filepath.Join(ws.Dir, filename))
+            if err != nil {
+                leaves = append(leaves, merkleLeaf{Name: filename, Hash: zeroHash})
+                if entry != nil && os.IsNotExist(err) {
+                    fmt.Printf("MISSING   %s (manifest %s)\n", filename, entry.SHA256)
+                } else {
+                    fmt.Printf("ERROR     %s: %v\n", filename, err)
+                }
+                status = 1
+                continue
+            }
+            leaves = append(leaves, merkleLeaf{Name: filename, Hash: h})
+
+            switch {
+            case len(manifest.Files) == 0:
+                fmt.Printf("%s  %s\n", h, filename)
+            case entry == nil:
+                fmt.Printf("UNTRACKED %s (local %s)\n", filename, h)
+            case entry.SHA256 != h:
+                fmt.Printf("MODIFIED  %s (local %s, manifest %s)\n", filename, h, entry.SHA256)
+                status = 1
+            default:
+                fmt.Printf("OK        %s\n", filename)
+            }
+        }
+
+        unifiedHash, err := merkleRoot(leaves)
+        if err != nil {
+            fmt.Printf("%s: Error computing Merkle root: %v\n", ws.Name, err)
+            return 1
+        }
+        fmt.Printf("%s: Unified Hash (Merkle root): 0x%s\n", ws.Name, unifiedHash)
+
+        if *expect != "" {
+            want := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(*expect)), "0x")
+            if want != unifiedHash {
+                fmt.Printf("MISMATCH: expected 0x%s\n", want)
+                return 1
+            }
+            fmt.Println("OK: unified hash matches")
+        }
+    }
+    return status
+}
+
+func cmdHistory(args []string) int {
+    fs, common := newFlagSet("history")
+    logOnly := fs.Bool("log", false, "print shift log entries for the file instead of its observed versions")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return 2
+    }
+    filter := ""
+    if len(positional) > 0 {
+        filter = positional[0]
+    }
+    _, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+    if filter != "" && !*logOnly {
+        return printVersions(sets, filter)
+    }
+
+    shown := 0
+    seen := map[string]bool{}
+    for _, ws := range sets {
+        for _, path := range logPaths(ws) {
+            if seen[path] {
+                continue
+            }
+            seen[path] = true
+
+            records, _, err := readLogRecords(path)
+            if err != nil {
+                fmt.Printf("Error reading log file %s: %v\n", path, err)
+                return 1
+            }
+            for _, rec := range records {
+                if filter != "" && rec.File != filter {
+                    continue
+                }
+                fmt.Printf("#%d %s %s %s\n", rec.Seq, rec.Time.Format(time.RFC3339), rec.Kind, rec.File)
+                fmt.Println(strings.TrimRight(rec.Text, "\n"))
+                fmt.Println()
+                shown++
+            }
+        }
+    }
+    if shown == 0 {
+        fmt.Println("No shifts recorded")
+    }
+    return 0
+}
+
+func printVersions(sets []*WatchSet, filename string) int {
+    found := false
+    for _, ws := range sets {
+        observations, err := fileObservations(ws, filename)
+        if err != nil {
+            fmt.Printf("%s: Error reading index: %v\n", ws.Name, err)
+            return 1
+        }
+        if len(observations) == 0 {
+            continue
+        }
+        found = true
+
+        versions := fileVersions(observations)
+        fmt.Printf("%s/%s: %d observations, %d versions\n", ws.Name, filename, len(observations), len(versions))
+        for i, v := range versions {
+            marker := " "
+            if i == len(versions)-1 {
+                marker = "*"
+            }
+            commit := ""
+            if v.Commit != "" {
+                commit = "  commit " + v.Commit[:12]
+            }
+            fmt.Printf("%s %s  %s .. %s  (%d cycles)%s\n", marker, v.Object[:12], v.FirstSeen.Local().Format(time.RFC3339), v.LastSeen.Local().Format(time.RFC3339), v.Cycles, commit)
+        }
+
+        failures := 0
+        for _, entry := range observations {
+            if entry.Object == "" {
+                failures++
+            }
+        }
+        if failures > 0 {
+            fmt.Printf("  %d observations without content (fetch failures)\n", failures)
+        }
+        if len(versions) > 1 {
+            fmt.Printf("Last changed: %s\n", versions[len(versions)-1].FirstSeen.Local().Format(time.RFC3339))
+        } else if len(versions) == 1 {
+            fmt.Println("Last changed: never (one version observed)")
+        }
+    }
+    if !found {
+        fmt.Printf("No observations recorded for %s\n", filename)
+        return 1
+    }
+    return 0
+}
+
+func findObservations(sets []*WatchSet, filename string) (*WatchSet, []IndexEntry, error) {
+    for _, ws := range sets {
+        observations, err := fileObservations(ws, filename)
+        if err != nil {
+            return nil, nil, fmt.Errorf("%s: Error reading index: %v", ws.Name, err)
+        }
+        if len(observations) > 0 {
+            return ws, observations, nil
+        }
+    }
+    return nil, nil, fmt.Errorf("No observations recorded for %s", filename)
+}
+
+func cmdShow(args []string) int {
+    fs, common := newFlagSet("show")
+    at := fs.String("at", "now", "time to reconstruct (RFC 3339, YYYY-MM-DD[ HH:MM], now, \"2h ago\" or object hash prefix)")
+    out := fs.String("out", "", "write the content to this file instead of stdout")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return 2
+    }
+    if len(positional) != 1 {
+        fmt.Println("Usage: integrity show <file> [--at TIME] [--out PATH]")
+        return 2
+    }
+    _, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    ws, observations, err := findObservations(sets, positional[0])
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+    entry, err := resolveVersion(ws, observations, *at)
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+    data, err := openStore(ws).get(entry.Object)
+    if err != nil {
+        fmt.Printf("Error reading object: %v\n", err)
+        return 1
+    }
+
+    if *out == "" {
+        os.Stdout.Write(data)
+        return 0
+    }
+    if err := os.WriteFile(*out, data, 0644); err != nil {
+        fmt.Printf("Error writing %s: %v\n", *out, err)
+        return 1
+    }
+    fmt.Printf("Wrote %s as observed %s (sha256 %s) to %s\n", positional[0], entry.Time.Local().Format(time.RFC3339), entry.Object, *out)
+    return 0
+}
+
+func cmdDiff(args []string) int {
+    fs, common := newFlagSet("diff")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return 2
+    }
+    if len(positional) != 3 {
+        fmt.Println("Usage: integrity diff <file> <timeA|hashA> <timeB|hashB>")
+        return 2
+    }
+    filename := positional[0]
+    _, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    ws, observations, err := findObservations(sets, filename)
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+    from, err := resolveVersion(ws, observations, positional[1])
+    if err != nil {
+        fmt.Printf("%s: %v\n", positional[1], err)
+        return 1
+    }
+    to, err := resolveVersion(ws, observations, positional[2])
+    if err != nil {
+        fmt.Printf("%s: %v\n", positional[2], err)
+        return 1
+    }
+
+    fmt.Printf("%s: %s (%s) -> %s (%s)\n", filename, from.Object[:12], from.Time.Local().Format(time.RFC3339), to.Object[:12], to.Time.Local().Format(time.RFC3339))
+    if from.Object == to.Object {
+        fmt.Println("Identical content")
+        return 0
+    }
+
+    store := openStore(ws)
+    body, err := store.get(to.Object)
+    if err != nil {
+        fmt.Printf("Error reading object: %v\n", err)
+        return 1
+    }
+    base, err := store.get(from.Object)
+    if err != nil {
+        fmt.Printf("Error reading object: %v\n", err)
+        return 1
+    }
+    ts := time.Now().Format("Jan 02, 2006 - 03:04PM")
+    fmt.Println(strings.TrimRight(generateDiff(ws, filename, store.path(from.Object), body, ts), "\n"))
+    if ws.fileType(filename) == "csv" {
+        fmt.Print(seriesFinding(ws, filename, base, body, ts))
+    }
+    return 0
+}
+
+func cmdDecide(action string, args []string) int {
+    fs, common := newFlagSet(action)
+    hash := fs.String("hash", "", "version to "+action+" (full hash, prefix or time; default: latest observed)")
+    reason := fs.String("reason", "", "why the version is being "+action+"ed")
+    by := fs.String("by", "", "who is deciding (default: current user)")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return 2
+    }
+    if len(positional) != 1 {
+        fmt.Printf("Usage: integrity %s <file> [--hash HASH] [--reason TEXT] [--by NAME]\n", action)
+        return 2
+    }
+    filename := positional[0]
+    _, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+    ws, _, err := findObservations(sets, filename)
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    who := *by
+    if who == "" {
+        who = currentUser()
+    }
+    target, err := resolveDecisionHash(ws, filename, *hash)
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    var decision *Decision
+    if action == "accept" {
+        decision, err = acceptVersion(ws, filename, target, who, *reason)
+    } else {
+        decision, err = rejectVersion(ws, filename, target, who, *reason)
+    }
+    if err != nil {
+        fmt.Printf("Error: %v\n", err)
+        return 1
+    }
+    fmt.Printf("%s: %sed %s by %s\n", filename, action, decision.Hash, decision.By)
+    return 0
+}
+
+func cmdProve(args []string) int {
+    fs, common := newFlagSet("prove")
+    local := fs.Bool("local", false, "build the tree from the current local files instead of the last cycle")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    if fs.NArg() != 1 {
+        fmt.Println("Usage: integrity prove [--local] <file>")
+        return 2
+    }
+    filename := fs.Arg(0)
+    _, sets, err := common.load()
+    if err != nil {
+        fmt.Println(err)
+        return 1
+    }
+
+    for _, ws := range sets {
+        var leaves []merkleLeaf
+        if *local {
+            manifest, err := loadManifest(ws)
+            if err != nil {
+                fmt.Printf("%s: Error loading manifest: %v\n", ws.Name, err)
+                return 1
+            }
+            filenames, err := trackedFiles(ws, manifest)
+            if err != nil {
+                fmt.Printf("%s: Error reading directory: %v\n", ws.Name, err)
+                return 1
+            }
+            for _, name := range filenames {
+                h, err := fileHash(filepath.Join(ws.Dir, name))
+                if err != nil {
+                    h = zeroHash
+                }
+                leaves = append(leaves, merkleLeaf{Name: name, Hash: h})
+            }
+        } else {
+            record, err := loadCycleRecord(ws)
+            if err != nil {
+                if os.IsNotExist(err) {
+                    continue
+                }
+                fmt.Printf("%s: Error loading cycle record: %v\n", ws.Name, err)
+                return 1
+            }
+            leaves = record.Leaves
+        }
+
+        proof, err := merkleProve(leaves, filename)
+        if err != nil {
+            continue
+        }
+        data, err := json.MarshalIndent(proof, "", "  ")
+        if err != nil {
+            fmt.Println(err)
+            return 1
+        }
+        fmt.Println(string(data))
+        return 0
+    }
+
+    fmt.Printf("%s not found in any recorded cycle (run a cycle first, or use --local)\n", filename)
+    return 1
+}
+
+func cmdVerifyProof(args []string) int {
+    fs := flag.NewFlagSet("verify-proof", flag.ContinueOnError)
+    root := fs.String("root", "", "root hash the proof must lead to (default: the root inside the proof)")
+    file := fs.String("file", "", "local file whose content must match the proven leaf")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    if fs.NArg() != 1 {
+        fmt.Println("Usage: integrity verify-proof [--root HASH] [--file PATH] <proof.json|->")
+        return 2
+    }
+
+    var data []byte
+    var err error
+    if fs.Arg(0) == "-" {
+        data, err = io.ReadAll(os.Stdin)
+    } else {
+        data, err = os.ReadFile(fs.Arg(0))
+    }
+    if err != nil {
+        fmt.Printf("Error reading proof: %v\n", err)
+        return 1
+    }
+
+    var proof MerkleProof
+    if err := json.Unmarshal(data, &proof); err != nil {
+        fmt.Printf("Error parsing proof: %v\n", err)
+        return 1
+    }
+
+    if *root != "" {
+        want := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(*root)), "0x")
+        if want != strings.ToLower(proof.Root) {
+            fmt.Printf("INVALID: proof is for root 0x%s, expected 0x%s\n", proof.Root, want)
+            return 1
+        }
+    }
+    if *file != "" {
+        h, err := fileHash(*file)
+        if err != nil {
+            fmt.Printf("Error hashing %s: %v\n", *file, err)
+            return 1
+        }
+        if h != proof.Leaf.Hash {
+            fmt.Printf("INVALID: %s has sha256 %s, proof leaf has %s\n", *file, h, proof.Leaf.Hash)
+            return 1
+        }
+    }
+    if err := verifyMerkleProof(&proof); err != nil {
+        fmt.Printf("INVALID: %v\n", err)
+        return 1
+    }
+
+    fmt.Printf("OK: %s (sha256 %s) is leaf %d of %d under root 0x%s\n", proof.Leaf.Name, proof.Leaf.Hash, proof.Index, proof.TreeSize, proof.Root)
+    return 0
+}
+
+func cmdKeygen(args []string) int {
+    fs, common := newFlagSet("keygen")
+    out := fs.String("out", "", "private key path (default: the watch set's signing_key); the public key is written to PATH.pub")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+
+    privPath := *out
+    if privPath == "" {
+        _, sets, err := common.load()
+        if err != nil {
+            fmt.Println(err)
+            return 1
+        }
+        if len(sets) > 1 {
+            fmt.Println("Several watch sets are configured; pick one with --set or give --out")
+            return 2
+        }
+        privPath = sets[0].SigningKey
+    }
+
+    pubPath := privPath + ".pub"
+    if err := generateKeyPair(privPath, pubPath); err != nil {
+        fmt.Printf("Error generating key: %v\n", err)
+        return 1
+    }
+    fmt.Printf("Private key: %s\nPublic key:  %s\n", privPath, pubPath)
+    return 0
+}
+
+func cmdVerifyReceipt(args []string) int {
+    fs := flag.NewFlagSet("verify-receipt", flag.ContinueOnError)
+    pubkey := fs.String("pubkey", "", "PEM public key the receipts must be signed with")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+    if *pubkey == "" || fs.NArg() == 0 {
+        fmt.Println("Usage: integrity verify-receipt --pubkey KEY.pub <receipt.json>...")
+        return 2
+    }
+    pub, err := loadPublicKey(*pubkey)
+    if err != nil {
+        fmt.Printf("Error loading public key: %v\n", err)
+        return 1
+    }
+
+    status := 0
+    for _, path := range fs.Args() {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            fmt.Printf("%s: %v\n", path, err)
+            status = 1
+            continue
+        }
+        receipt, err := verifyReceipt(data, pub)
+        if err != nil {
+            fmt.Printf("INVALID %s: %v\n", path, err)
+            status = 1
+            continue
+        }
+
+        counts := map[string]int{}
+        for _, f := range receipt.Files {
+            counts[f.Status]++
+        }
+        var summary []string
+        for _, st := range sortedKeys(counts) {
+            summary = append(summary, fmt.Sprintf("%d %s", counts[st], st))
+        }
+        fmt.Printf("OK %s: %s cycle %s - %s, root 0x%s, %d files (%s)\n", path, receipt.WatchSet,
+            receipt.StartedAt.Format(time.RFC3339), receipt.CompletedAt.Format(time.RFC3339), receipt.Root, len(receipt.Files), strings.Join(summary, ", "))
+    }
+    return status
+}
+
+func cmdVerifyLog(args []string) int {
+    fs, common := newFlagSet("verify-log")
+    pubkey := fs.String("pubkey", "", "require every record to be signed by this PEM public key")
+    headSeq := fs.Int64("seq", 0, "expected head sequence number, used with --head")
+    headHash := fs.String("head", "", "expected head record hash (default: the .head file next to the log)")
+    if err := fs.Parse(args); err != nil {
+        return 2
+    }
+
+    var pub ed25519.PublicKey
+    if *pubkey != "" {
+        var err error
+        if pub, err = loadPublicKey(*pubkey); err != nil {
+            fmt.Printf("Error loading public key: %v\n", err)
+            return 1
+        }
+    }
+    var expected *LogHead
+    if *headHash != "" {
+        expected = &LogHead{Seq: *headSeq, Hash: strings.ToLower(*headHash)}
+    }
+
+    var paths []string
+    if fs.NArg() > 0 {
+        paths = fs.Args()
+    } else {
+        _, sets, err := common.load()
+        if err != nil {
+            fmt.Println(err)
+            return 1
+        }
+        seen := map[string]bool{}
+        for _, ws := range sets {
+            for _, path := range logPaths(ws) {
+                if !seen[path] {
+                    seen[path] = true
+                    paths = append(paths, path)
+                }
+            }
+        }
+    }
+
+    status := 0
+    for _, path := range paths {
+        head, problems, err := verifyChainedLog(path, pub, expected)
+        if err != nil {
+            fmt.Printf("%s: %v\n", path, err)
+            status = 1
+            continue
+        }
+        if len(problems) > 0 {
+            fmt.Printf("INVALID %s:\n", path)
+            for _, problem := range problems {
+                fmt.Printf("  %s\n", problem)
+            }
+            status = 1
+            continue
+        }
+        fmt.Printf("OK %s: %d records, head %s\n", path, head.Seq, head.Hash)
+    }
+    return status
+}
+
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+    var positional []string
+    for {
+        if err := fs.Parse(args); err != nil {
+            return nil, err
+        }
+        if fs.NArg() == 0 {
+            return positional, nil
+        }
+        positional = append(positional, fs.Arg(0))
+        args = fs.Args()[1:]
+    }
+}
+
+func sortedKeys(m map[string]int) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func watchLoop(ctx context.Context, sets []*WatchSet, interval int) {
+    for {
+        for _, ws := range sets {
+            // Failures are already logged; the next cycle retries.
+            runCycle(ctx, ws)
+        }
+        select {
+        case <-ctx.Done():
+            fmt.Println("Stopping watch")
+            return
+        case <-time.After(time.Duration(interval) * time.Minute):
+        }
+    }
+}
+
+func scanDir(ws *WatchSet) ([]string, error) {
+    dir, err := os.Open(ws.Dir)
+    if err != nil {
+        return nil, err
+    }
+    defer dir.Close()
+
+    names, err := dir.Readdirnames(-1)
+    if err != nil {
+        return nil, err
+    }
+
+    var filenames []string
+    for _, filename := range names {
+        if ws.matches(filename) {
+            filenames = append(filenames, filename)
+        }
+    }
+    sort.Strings(filenames)
+    return filenames, nil
+}
+
+func resolveDir(flagValue string) (string, error) {
+    dir := flagValue
+    if dir == "" {
+        dir = os.Getenv("INTEGRITY_DIR")
+    }
+    if dir == "" {
+        return os.Getwd()
+    }
+    return filepath.Abs(dir)
+}
+
+func envInterval() (int, bool) {
+    text := strings.TrimSpace(os.Getenv("INTEGRITY_INTERVAL"))
+    if text == "" {
+        return 0, false
+    }
+    if v, err := strconv.Atoi(text); err == nil && v > 0 {
+        return v, true
+    }
+    fmt.Printf("Ignoring invalid INTEGRITY_INTERVAL %q\n", text)
+    return 0, false
+}
+
+func intervalOrDefault(flagValue int, cfg *Config) int {
+    if flagValue > 0 {
+        return flagValue
+    }
+    if v, ok := envInterval(); ok {
+        return v
+    }
+    if cfg.Interval > 0 {
+        return cfg.Interval
+    }
+    return defaultMinutes
+}
+
+func stdinIsTerminal() bool {
+    fi, err := os.Stdin.Stat()
+    if err != nil {
+        return false
+    }
+    return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = "integrity.yaml"
+
+type Config struct {
+    Interval  int         `yaml:"interval"`
+    WatchSets []*WatchSet `yaml:"watch_sets"`
+}
+
+type WatchSet struct {
+    Name       string          `yaml:"name"`
+    Remote     string          `yaml:"remote"`
+    Source     SourceConfig    `yaml:"source"`
+    Mirrors    []MirrorConfig  `yaml:"mirrors"`
+    Profiles   []ProfileConfig `yaml:"profiles"`
+    Cloaking   CloakingConfig  `yaml:"cloaking"`
+    Stability  StabilityConfig `yaml:"stability"`
+    Dir        string          `yaml:"dir"`
+    StateDir   string          `yaml:"state_dir"`
+    SigningKey string          `yaml:"signing_key"`
+    Include    []string        `yaml:"include"`
+    Exclude    []string        `yaml:"exclude"`
+    FetchPause *Duration       `yaml:"fetch_pause"`
+    Fetch      FetchConfig     `yaml:"fetch"`
+    Diff       DiffConfig      `yaml:"diff"`
+    Outputs    []OutputConfig  `yaml:"outputs"`
+}
+
+type SourceConfig struct {
+    Type    string `yaml:"type"`
+    URL     string `yaml:"url"`
+    Path    string `yaml:"path"`
+    Ref     string `yaml:"ref"`
+    Listing string `yaml:"listing"`
+}
+
+type MirrorConfig struct {
+    Name         string `yaml:"name"`
+    SourceConfig `yaml:",inline"`
+}
+
+type ProfileConfig struct {
+    Name           string            `yaml:"name"`
+    UserAgent      string            `yaml:"user_agent"`
+    Headers        map[string]string `yaml:"headers"`
+    AcceptEncoding string            `yaml:"accept_encoding"`
+}
+
+type CloakingConfig struct {
+    Profiles []string `yaml:"profiles"`
+}
+
+type StabilityConfig struct {
+    Confirmations int      `yaml:"confirmations"`
+    FlapThreshold int      `yaml:"flap_threshold"`
+    FlapWindow    Duration `yaml:"flap_window"`
+}
+
+type FetchConfig struct {
+    Profile      string    `yaml:"profile"`
+    Concurrency  int       `yaml:"concurrency"`
+    PerHost      int       `yaml:"per_host"`
+    RatePerHost  float64   `yaml:"rate_per_host"`
+    Burst        int       `yaml:"burst"`
+    CheapCheck   string    `yaml:"cheap_check"`
+    FullInterval *Duration `yaml:"full_interval"`
+    Retries      *int      `yaml:"retries"`
+    Backoff      Duration  `yaml:"backoff"`
+    MaxBackoff   Duration  `yaml:"max_backoff"`
+    Timeout      Duration  `yaml:"timeout"`
+    MaxSize      int64     `yaml:"max_size"`
+}
+
+type DiffConfig struct {
+    MaxChars int             `yaml:"max_chars"`
+    CSV      CSVDiffConfig   `yaml:"csv"`
+    PDF      PDFDiffConfig   `yaml:"pdf"`
+    Image    ImageDiffConfig `yaml:"image"`
+}
+
+type CSVDiffConfig struct {
+    Extensions []string         `yaml:"extensions"`
+    MaxChanges int              `yaml:"max_changes"`
+    Parse      string           `yaml:"parse"`
+    Tolerance  ToleranceConfig  `yaml:"tolerance"`
+    Tables     []CSVTableConfig `yaml:"tables"`
+}
+
+// A numeric field change is ignored when it is within Absolute of the old
+// value or within Relative of it as a fraction (1e-6 = one part per million).
+type ToleranceConfig struct {
+    Absolute float64 `yaml:"absolute"`
+    Relative float64 `yaml:"relative"`
+}
+
+func (t ToleranceConfig) invalid() bool {
+    return t.Absolute < 0 || t.Relative < 0
+}
+
+// CSVTableConfig applies to the CSV files whose name matches the Match glob.
+// Key names the header columns that identify a row; Parse overrides the
+// csv-level parse mode. Format "fixed" reads a fixed-width text table
+// instead, with Columns giving the field positions when the header block
+// has no '|' dividers to take them from. Tolerance overrides the csv-level
+// tolerance for the table and Tolerances for single columns by header name.
+// TimeColumn marks the table as a time series keyed by that date column and
+// logs a summary of the whole series next to its diffs.
+type CSVTableConfig struct {
+    Match      string                     `yaml:"match"`
+    Key        []string                   `yaml:"key"`
+    Parse      string                     `yaml:"parse"`
+    Format     string                     `yaml:"format"`
+    Columns    []FixedColumn              `yaml:"columns"`
+    Tolerance  *ToleranceConfig           `yaml:"tolerance"`
+    Tolerances map[string]ToleranceConfig `yaml:"tolerances"`
+    TimeColumn string                     `yaml:"time_column"`
+}
+
+// FixedColumn is a 1-based, inclusive character range; End 0 runs to the
+// end of the line.
+type FixedColumn struct {
+    Name  string `yaml:"name"`
+    Start int    `yaml:"start"`
+    End   int    `yaml:"end"`
+}
+
+type PDFDiffConfig struct {
+    Extensions []string `yaml:"extensions"`
+}
+
+type ImageDiffConfig struct {
+    Extensions []string `yaml:"extensions"`
+    MaxChanges int      `yaml:"max_changes"`
+    EXIF       *bool    `yaml:"exif"`
+    OCR        *bool    `yaml:"ocr"`
+}
+
+type OutputConfig struct {
+    Type string `yaml:"type"`
+    Path string `yaml:"path"`
+    URL  string `yaml:"url"`
+    Sign bool   `yaml:"sign"`
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+    v, err := time.ParseDuration(node.Value)
+    if err != nil {
+        return fmt.Errorf("line %d: invalid duration %q (use e.g. \"5s\" or \"1m30s\")", node.Line, node.Value)
+    }
+    *d = Duration(v)
+    return nil
+}
+
+func loadConfig(path string) (*Config, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var cfg Config
+    dec := yaml.NewDecoder(bytes.NewReader(data))
+    dec.KnownFields(true)
+    if err := dec.Decode(&cfg); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+
+    absPath, err := filepath.Abs(path)
+    if err != nil {
+        return nil, err
+    }
+    baseDir := filepath.Dir(absPath)
+    for _, ws := range cfg.WatchSets {
+        if ws != nil {
+            ws.applyDefaults(baseDir)
+        }
+    }
+
+    if err := cfg.validate(); err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    return &cfg, nil
+}
+
+func defaultConfig(dir string) *Config {
+    ws := &WatchSet{Name: "default", Dir: dir}
+    ws.applyDefaults(dir)
+    return &Config{WatchSets: []*WatchSet{ws}}
+}
+
+func (ws *WatchSet) applyDefaults(baseDir string) {
+    if ws.Remote != "" && !strings.HasSuffix(ws.Remote, "/") {
+        ws.Remote += "/"
+    }
+    if ws.Source.Type == "" {
+        ws.Source.Type = "http"
+        ws.Source.URL = ws.Remote
+        if ws.Source.URL == "" {
+            ws.Source.URL = baseURL
+        }
+    }
+    if ws.Dir == "" {
+        ws.Dir = baseDir
+    } else if !filepath.IsAbs(ws.Dir) {
+        ws.Dir = filepath.Join(baseDir, ws.Dir)
+    }
+    if ws.StateDir == "" {
+        ws.StateDir = filepath.Join(ws.Dir, ".integrity")
+    } else if !filepath.IsAbs(ws.StateDir) {
+        ws.StateDir = filepath.Join(baseDir, ws.StateDir)
+    }
+    ws.Source.applyDefaults(baseDir, filepath.Join(ws.StateDir, "mirror.git"))
+    for i := range ws.Mirrors {
+        m := &ws.Mirrors[i]
+        if m.Name == "" {
+            m.Name = fmt.Sprintf("mirror-%d", i+1)
+        }
+        if m.Type == "" {
+            m.Type = "http"
+        }
+        m.applyDefaults(baseDir, filepath.Join(ws.StateDir, "mirrors", m.Name+".git"))
+    }
+    if ws.SigningKey == "" {
+        ws.SigningKey = filepath.Join(ws.StateDir, "receipt.key")
+    } else if !filepath.IsAbs(ws.SigningKey) {
+        ws.SigningKey = filepath.Join(baseDir, ws.SigningKey)
+    }
+    if len(ws.Include) == 0 {
+        ws.Include = []string{"*.csv", "*.pdf"}
+        for _, ext := range imageExts {
+            ws.Include = append(ws.Include, "*map*"+ext)
+        }
+    }
+    if ws.Fetch.Profile == "" {
+        ws.Fetch.Profile = defaultProfile
+    }
+    if ws.Fetch.Concurrency == 0 {
+        ws.Fetch.Concurrency = defaultConcurrency
+    }
+    if ws.Fetch.PerHost == 0 {
+        ws.Fetch.PerHost = ws.Fetch.Concurrency
+    }
+    if ws.Fetch.RatePerHost == 0 {
+        switch {
+        case ws.FetchPause == nil && ws.Source.Type == "http":
+            ws.Fetch.RatePerHost = defaultRatePerHost
+        case ws.FetchPause != nil && *ws.FetchPause > 0:
+            ws.Fetch.RatePerHost = 1 / time.Duration(*ws.FetchPause).Seconds()
+        default:
+            ws.Fetch.RatePerHost = -1
+        }
+    }
+    if ws.Fetch.Burst == 0 {
+        ws.Fetch.Burst = 1
+    }
+    if ws.Fetch.CheapCheck == "" {
+        ws.Fetch.CheapCheck = "off"
+    }
+    if ws.Fetch.FullInterval == nil {
+        interval := Duration(defaultFullInterval)
+        ws.Fetch.FullInterval = &interval
+    }
+    if ws.Fetch.Retries == nil {
+        retries := defaultRetries
+        ws.Fetch.Retries = &retries
+    }
+    if ws.Fetch.Backoff == 0 {
+        ws.Fetch.Backoff = Duration(time.Second)
+    }
+    if ws.Fetch.MaxBackoff == 0 {
+        ws.Fetch.MaxBackoff = Duration(30 * time.Second)
+    }
+    if ws.Fetch.Timeout == 0 {
+        ws.Fetch.Timeout = Duration(30 * time.Second)
+    }
+    if ws.Fetch.MaxSize == 0 {
+        ws.Fetch.MaxSize = defaultMaxSize
+    }
+    if ws.Stability.Confirmations == 0 {
+        ws.Stability.Confirmations = 1
+    }
+    if ws.Stability.FlapThreshold == 0 {
+        ws.Stability.FlapThreshold = defaultFlapThreshold
+    }
+    if ws.Stability.FlapWindow == 0 {
+        ws.Stability.FlapWindow = Duration(24 * time.Hour)
+    }
+    if ws.Diff.MaxChars == 0 {
+        ws.Diff.MaxChars = maxDiffChars
+    }
+    if len(ws.Diff.CSV.Extensions) == 0 {
+        ws.Diff.CSV.Extensions = []string{".csv"}
+    }
+    if ws.Diff.CSV.Parse == "" {
+        ws.Diff.CSV.Parse = "strict"
+    }
+    if ws.Diff.CSV.MaxChanges == 0 {
+        ws.Diff.CSV.MaxChanges = maxDiffChanges
+    }
+    if len(ws.Diff.PDF.Extensions) == 0 {
+        ws.Diff.PDF.Extensions = []string{".pdf"}
+    }
+    if len(ws.Diff.Image.Extensions) == 0 {
+        ws.Diff.Image.Extensions = imageExts
+    }
+    if ws.Diff.Image.MaxChanges == 0 {
+        ws.Diff.Image.MaxChanges = maxDiffChanges
+    }
+    if ws.Diff.Image.EXIF == nil {
+        enabled := true
+        ws.Diff.Image.EXIF = &enabled
+    }
+    if ws.Diff.Image.OCR == nil {
+        enabled := true
+        ws.Diff.Image.OCR = &enabled
+    }
+    if len(ws.Outputs) == 0 {
+        ws.Outputs = []OutputConfig{{Type: "file", Path: logFile}}
+    }
+    for i := range ws.Outputs {
+        if ws.Outputs[i].Type == "file" && ws.Outputs[i].Path != "" && !filepath.IsAbs(ws.Outputs[i].Path) {
+            ws.Outputs[i].Path = filepath.Join(baseDir, ws.Outputs[i].Path)
+        }
+    }
+}
+
+func (cfg *Config) validate() error {
+    var errs []string
+    if cfg.Interval < 0 {
+        errs = append(errs, "interval: must be a positive number of minutes")
+    }
+    if len(cfg.WatchSets) == 0 {
+        errs = append(errs, "watch_sets: at least one watch set is required")
+    }
+
+    names := map[string]bool{}
+    for i, ws := range cfg.WatchSets {
+        prefix := fmt.Sprintf("watch_sets[%d]", i)
+        if ws == nil {
+            errs = append(errs, prefix+": empty entry")
+            continue
+        }
+        if ws.Name == "" {
+            errs = append(errs, prefix+".name: required")
+        } else if names[ws.Name] {
+            errs = append(errs, fmt.Sprintf("%s.name: duplicate watch set name %q", prefix, ws.Name))
+        } else {
+            prefix = fmt.Sprintf("watch_sets[%d] (%s)", i, ws.Name)
+        }
+        names[ws.Name] = true
+
+        if ws.Remote != "" && (ws.Source.Type != "http" || ws.Source.URL != ws.Remote) {
+            errs = append(errs, prefix+": remote is shorthand for an http source; set source.url instead when using source")
+        }
+        errs = append(errs, ws.Source.validate(prefix+".source")...)
+        mirrorNames := map[string]bool{primaryMirror: true}
+        for j := range ws.Mirrors {
+            m := &ws.Mirrors[j]
+            mirrorPrefix := fmt.Sprintf("%s.mirrors[%d]", prefix, j)
+            if mirrorNames[m.Name] {
+                errs = append(errs, fmt.Sprintf("%s.name: duplicate or reserved mirror name %q", mirrorPrefix, m.Name))
+            }
+            mirrorNames[m.Name] = true
+            errs = append(errs, m.validate(mirrorPrefix)...)
+        }
+        if fi, err := os.Stat(ws.Dir); err != nil {
+            errs = append(errs, fmt.Sprintf("%s.dir: %v", prefix, err))
+        } else if !fi.IsDir() {
+            errs = append(errs, fmt.Sprintf("%s.dir: %s is not a directory", prefix, ws.Dir))
+        }
+        for _, pattern := range append(append([]string{}, ws.Include...), ws.Exclude...) {
+            if _, err := filepath.Match(pattern, ""); err != nil {
+                errs = append(errs, fmt.Sprintf("%s: bad glob %q: %v", prefix, pattern, err))
+            }
+        }
+        if ws.FetchPause != nil && *ws.FetchPause < 0 {
+            errs = append(errs, prefix+".fetch_pause: must not be negative")
+        }
+        profileSeen := map[string]bool{}
+        for j, p := range ws.Profiles {
+            if p.Name == "" {
+                errs = append(errs, fmt.Sprintf("%s.profiles[%d].name: required", prefix, j))
+            } else if profileSeen[p.Name] {
+                errs = append(errs, fmt.Sprintf("%s.profiles[%d].name: duplicate profile %q", prefix, j, p.Name))
+            }
+            profileSeen[p.Name] = true
+        }
+        for _, name := range append([]string{ws.Fetch.Profile}, ws.Cloaking.Profiles...) {
+            if ws.profile(name) == nil {
+                errs = append(errs, fmt.Sprintf("%s: unknown request profile %q (have %s)", prefix, name, strings.Join(profileNames(ws), ", ")))
+            }
+        }
+        switch ws.Fetch.CheapCheck {
+        case "off", "head", "conditional":
+        default:
+            errs = append(errs, fmt.Sprintf("%s.fetch.cheap_check: unknown mode %q (want off, head or conditional)", prefix, ws.Fetch.CheapCheck))
+        }
+        if *ws.Fetch.FullInterval < 0 {
+            errs = append(errs, prefix+".fetch.full_interval: must not be negative")
+        }
+        if *ws.Fetch.Retries < 0 || ws.Fetch.Backoff < 0 || ws.Fetch.MaxBackoff < 0 || ws.Fetch.Timeout < 0 {
+            errs = append(errs, prefix+".fetch: retries, backoff, max_backoff and timeout must not be negative")
+        }
+        if ws.Fetch.MaxSize < 0 {
+            errs = append(errs, prefix+".fetch.max_size: must be a positive number of bytes")
+        }
+        if len(ws.Cloaking.Profiles) > 0 && ws.Source.Type != "http" {
+            errs = append(errs, prefix+".cloaking: request profiles only apply to http sources")
+        }
+        if ws.Fetch.Concurrency < 0 || ws.Fetch.PerHost < 0 || ws.Fetch.Burst < 0 {
+            errs = append(errs, prefix+".fetch: concurrency, per_host and burst must not be negative")
+        }
+        if ws.Stability.Confirmations < 0 || ws.Stability.FlapThreshold < 0 || ws.Stability.FlapWindow < 0 {
+            errs = append(errs, prefix+".stability: confirmations, flap_threshold and flap_window must not be negative")
+        }
+        if ws.Diff.MaxChars < 0 || ws.Diff.CSV.MaxChanges < 0 || ws.Diff.Image.MaxChanges < 0 {
+            errs = append(errs, prefix+".diff: limits must not be negative")
+        }
+        if ws.Diff.CSV.Parse != "strict" && ws.Diff.CSV.Parse != "lenient" {
+            errs = append(errs, fmt.Sprintf("%s.diff.csv.parse: unknown mode %q (want strict or lenient)", prefix, ws.Diff.CSV.Parse))
+        }
+        if ws.Diff.CSV.Tolerance.invalid() {
+            errs = append(errs, prefix+".diff.csv.tolerance: must not be negative")
+        }
+        for j, t := range ws.Diff.CSV.Tables {
+            tablePrefix := fmt.Sprintf("%s.diff.csv.tables[%d]", prefix, j)
+            if _, err := filepath.Match(t.Match, ""); t.Match == "" || err != nil {
+                errs = append(errs, fmt.Sprintf("%s.match: %q is not a valid glob", tablePrefix, t.Match))
+            }
+            if t.Parse != "" && t.Parse != "strict" && t.Parse != "lenient" {
+                errs = append(errs, fmt.Sprintf("%s.parse: unknown mode %q (want strict or lenient)", tablePrefix, t.Parse))
+            }
+            if t.Format != "" && t.Format != "csv" && t.Format != "fixed" {
+                errs = append(errs, fmt.Sprintf("%s.format: unknown format %q (want csv or fixed)", tablePrefix, t.Format))
+            }
+            if len(t.Columns) > 0 && t.Format != "fixed" {
+                errs = append(errs, tablePrefix+".columns: only used with format fixed")
+            }
+            if t.Tolerance != nil && t.Tolerance.invalid() {
+                errs = append(errs, tablePrefix+".tolerance: must not be negative")
+            }
+            for column, tol := range t.Tolerances {
+                if tol.invalid() {
+                    errs = append(errs, fmt.Sprintf("%s.tolerances[%q]: must not be negative", tablePrefix, column))
+                }
+            }
+            for k, c := range t.Columns {
+                if c.Name == "" || c.Start < 1 || (c.End != 0 && c.End < c.Start) {
+                    errs = append(errs, fmt.Sprintf("%s.columns[%d]: needs a name, start >= 1 and end >= start (or 0)", tablePrefix, k))
+                }
+            }
+        }
+        for j, out := range ws.Outputs {
+            outPrefix := fmt.Sprintf("%s.outputs[%d]", prefix, j)
+            switch out.Type {
+            case "file":
+                if out.Path == "" {
+                    errs = append(errs, outPrefix+".path: required for file output")
+                }
+            case "stdout":
+            case "webhook":
+                if u, err := url.Parse(out.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+                    errs = append(errs, fmt.Sprintf("%s.url: %q is not an http(s) URL", outPrefix, out.URL))
+                }
+            default:
+                errs = append(errs, fmt.Sprintf("%s.type: unknown output type %q (want file, stdout or webhook)", outPrefix, out.Type))
+            }
+        }
+    }
+
+    if len(errs) > 0 {
+        return errors.New("invalid config:\n  " + strings.Join(errs, "\n  "))
+    }
+    return nil
+}
+
+func (c *SourceConfig) applyDefaults(baseDir, mirrorPath string) {
+    switch c.Type {
+    case "http":
+        if c.URL != "" && !strings.HasSuffix(c.URL, "/") {
+            c.URL += "/"
+        }
+    case "dir", "git":
+        if c.Path != "" && !filepath.IsAbs(c.Path) {
+            c.Path = filepath.Join(baseDir, c.Path)
+        }
+        if c.Type == "git" && c.Path == "" && c.URL != "" {
+            c.Path = mirrorPath
+        }
+        if c.Type == "git" && c.Ref == "" {
+            c.Ref = "HEAD"
+        }
+    }
+}
+
+func (c *SourceConfig) validate(prefix string) []string {
+    var errs []string
+    switch c.Type {
+    case "http":
+        if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            errs = append(errs, fmt.Sprintf("%s.url: %q is not an http(s) URL", prefix, c.URL))
+        }
+    case "dir", "git":
+        // A git source with a url clones its mirror on first use.
+        mirrored := c.Type == "git" && c.URL != ""
+        if c.Path == "" {
+            errs = append(errs, fmt.Sprintf("%s.path: required for %s source", prefix, c.Type))
+        } else if fi, err := os.Stat(c.Path); err != nil {
+            if !mirrored || !os.IsNotExist(err) {
+                errs = append(errs, fmt.Sprintf("%s.path: %v", prefix, err))
+            }
+        } else if !fi.IsDir() {
+            errs = append(errs, fmt.Sprintf("%s.path: %s is not a directory", prefix, c.Path))
+        }
+        if c.Type == "dir" && c.URL != "" {
+            errs = append(errs, prefix+".url: not used by dir source")
+        }
+        if c.Listing != "" {
+            errs = append(errs, fmt.Sprintf("%s.listing: only used by http source (%s sources are listed directly)", prefix, c.Type))
+        }
+    default:
+        errs = append(errs, fmt.Sprintf("%s.type: unknown source type %q (want http, dir or git)", prefix, c.Type))
+    }
+    return errs
+}
+
+func (cfg *Config) selectSets(name string) ([]*WatchSet, error) {
+    if name == "" {
+        return cfg.WatchSets, nil
+    }
+    for _, ws := range cfg.WatchSets {
+        if ws.Name == name {
+            return []*WatchSet{ws}, nil
+        }
+    }
+    return nil, fmt.Errorf("no watch set named %q", name)
+}
+
+func (ws *WatchSet) matches(filename string) bool {
+    name := strings.ToLower(filename)
+    included := false
+    for _, pattern := range ws.Include {
+        if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+            included = true
+            break
+        }
+    }
+    if !included {
+        return false
+    }
+    for _, pattern := range ws.Exclude {
+        if ok, _ := filepath.Match(strings.ToLower(pattern), name); ok {
+            return false
+        }
+    }
+    return ws.fileType(filename) != ""
+}
+
+// table returns the first table entry matching filename, or nil.
+func (c *CSVDiffConfig) table(filename string) *CSVTableConfig {
+    name := strings.ToLower(filename)
+    for i := range c.Tables {
+        if ok, _ := filepath.Match(strings.ToLower(c.Tables[i].Match), name); ok {
+            return &c.Tables[i]
+        }
+    }
+    return nil
+}
+
+func (c *CSVDiffConfig) parseMode(filename string) string {
+    if t := c.table(filename); t != nil && t.Parse != "" {
+        return t.Parse
+    }
+    return c.Parse
+}
+
+func (c *CSVDiffConfig) tolerance(t *CSVTableConfig, column string) ToleranceConfig {
+    if t != nil {
+        if tol, ok := t.Tolerances[column]; ok {
+            return tol
+        }
+        if t.Tolerance != nil {
+            return *t.Tolerance
+        }
+    }
+    return c.Tolerance
+}
+
+func (ws *WatchSet) fileType(filename string) string {
+    ext := strings.ToLower(filepath.Ext(filename))
+    for _, e := range ws.Diff.CSV.Extensions {
+        if ext == strings.ToLower(e) {
+            return "csv"
+        }
+    }
+    for _, e := range ws.Diff.PDF.Extensions {
+        if ext == strings.ToLower(e) {
+            return "pdf"
+        }
+    }
+    for _, e := range ws.Diff.Image.Extensions {
+        if ext == strings.ToLower(e) {
+            return "image"
+        }
+    }
+    return ""
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+)
+
+// maxAlignCost bounds the number of row inserts and deletes the Myers search
+// explores. Past it the rows between the common prefix and suffix are
+// reported as replaced wholesale rather than aligned.
+const maxAlignCost = 1024
+
+type rowEdit struct {
+    Op   byte // '=', '-' (local row omitted) or '+' (remote row added)
+    A, B int  // row indexes in the local and remote tables, -1 when absent
+}
+
+type csvReport struct {
+    out     strings.Builder
+    max     int
+    changes int
+    shown   int
+    notes   int
+
+    tolerance   func(column string) ToleranceConfig
+    reformatted []string
+    tolerated   int
+}
+
+// change records a row-level change, of which only the first max are shown.
+func (r *csvReport) change(line string) {
+    r.changes++
+    if r.shown < r.max {
+        r.shown++
+        r.out.WriteString(line)
+    }
+}
+
+// field describes a changed field, or returns "" when only its formatting
+// changed or the numeric change is within tolerance; those are tallied and
+// summarised once at the end of the diff.
+func (r *csvReport) field(row, column, name, localField, remoteField string) string {
+    kind, note := compareFields(localField, remoteField, r.tolerance(name))
+    switch kind {
+    case formatOnly:
+        r.reformatted = append(r.reformatted, fmt.Sprintf("%s, %s: '%s' → '%s'", row, column, localField, remoteField))
+        return ""
+    case withinTolerance:
+        r.tolerated++
+        return ""
+    }
+    if note != "" {
+        note = " (" + note + ")"
+    }
+    return fmt.Sprintf("Modified field in %s, %s: '%s' → '%s'%s\n", row, column, localField, remoteField, note)
+}
+
+// note records a table-level finding, which is always shown.
+func (r *csvReport) note(line string) {
+    r.notes++
+    r.out.WriteString(line)
+}
+
+func generateCSVDiff(localPath string, remoteData []byte, ts, filename string, opts CSVDiffConfig) string {
+    localData, err := os.ReadFile(localPath)
+    if err != nil {
+        return fmt.Sprintf("[%s] CSV: %s | Error reading local: %v", ts, filename, err)
+    }
+    localCSV, localPreamble, err := readTable(&opts, filename, localData)
+    if err != nil {
+        return fmt.Sprintf("[%s] CSV: %s | Error parsing local: %v", ts, filename, err)
+    }
+    remoteCSV, remotePreamble, err := readTable(&opts, filename, remoteData)
+    if err != nil {
+        return fmt.Sprintf("[%s] CSV: %s | Error parsing remote: %v", ts, filename, err)
+    }
+    table := opts.table(filename)
+
+    r := &csvReport{max: opts.MaxChanges, tolerance: func(column string) ToleranceConfig {
+        return opts.tolerance(table, column)
+    }}
+    r.out.WriteString(fmt.Sprintf("[%s] Diff for %s\n", ts, filename))
+
+    for i := 0; i < len(localPreamble) || i < len(remotePreamble); i++ {
+        if a, b := field(localPreamble, i), field(remotePreamble, i); a != b {
+            r.note(fmt.Sprintf("Preamble line %d: '%s' → '%s'\n", i+1, a, b))
+        }
+    }
+
+    if table != nil && len(table.Key) > 0 {
+        if err := diffKeyedRows(r, localCSV, remoteCSV, table.Key); err != nil {
+            r.out.WriteString(fmt.Sprintf("Key columns unusable (%v); comparing rows by position\n", err))
+            diffAlignedRows(r, localCSV, remoteCSV)
+        }
+    } else {
+        diffAlignedRows(r, localCSV, remoteCSV)
+    }
+
+    if r.changes > r.shown {
+        r.out.WriteString(fmt.Sprintf("... %d more changed rows not shown\n", r.changes-r.shown))
+    }
+    if n := len(r.reformatted); n > 0 {
+        r.out.WriteString(fmt.Sprintf("Formatting-only changes (same value) in %d fields, e.g. %s\n", n, r.reformatted[0]))
+    }
+    if r.tolerated > 0 {
+        r.out.WriteString(fmt.Sprintf("Numeric changes within tolerance in %d fields\n", r.tolerated))
+    }
+    if r.changes+r.notes+len(r.reformatted)+r.tolerated == 0 {
+        r.out.WriteString("No specific changes identified (full content mismatch)\n")
+    }
+
+    return r.out.String()
+}
+
+func diffAlignedRows(r *csvReport, localCSV, remoteCSV [][]string) {
+    edits, aligned := alignRows(rowKeys(localCSV), rowKeys(remoteCSV))
+    if !aligned {
+        r.out.WriteString("Rows differ too much to align; changed region reported as omitted and added rows\n")
+    }
+
+    for start := 0; start < len(edits); {
+        if edits[start].Op == '=' {
+            start++
+            continue
+        }
+        end := start
+        var omitted, added []int
+        for ; end < len(edits) && edits[end].Op != '='; end++ {
+            if edits[end].Op == '-' {
+                omitted = append(omitted, edits[end].A)
+            } else {
+                added = append(added, edits[end].B)
+            }
+        }
+        start = end
+
+        // Within a hunk, pair omitted and added rows in order and treat a
+        // pair as one modified row when most of its fields survived.
+        paired := len(omitted)
+        if len(added) < paired {
+            paired = len(added)
+        }
+        for i := 0; i < paired; i++ {
+            a, b := omitted[i], added[i]
+            if rowsRelated(localCSV[a], remoteCSV[b]) {
+                if mods := r.modifiedRow(a, b, localCSV[0], localCSV[a], remoteCSV[b]); mods != "" {
+                    r.change(mods)
+                }
+            } else {
+                r.change(fmt.Sprintf("Omitted row %d: %s\n", a+1, strings.Join(localCSV[a], ",")))
+                r.change(fmt.Sprintf("Added row %d: %s\n", b+1, strings.Join(remoteCSV[b], ",")))
+            }
+        }
+        for _, a := range omitted[paired:] {
+            r.change(fmt.Sprintf("Omitted row %d: %s\n", a+1, strings.Join(localCSV[a], ",")))
+        }
+        for _, b := range added[paired:] {
+            r.change(fmt.Sprintf("Added row %d: %s\n", b+1, strings.Join(remoteCSV[b], ",")))
+        }
+    }
+}
+
+// modifiedRow lists every field that differs in value between two aligned
+// rows. Row numbers are 1-based; the remote row number is given when
+// inserts or deletes above the row have shifted it. Columns are named by
+// position, with the local header naming them for tolerance lookups.
+func (r *csvReport) modifiedRow(a, b int, header, localRow, remoteRow []string) string {
+    row := fmt.Sprintf("row %d", a+1)
+    if a != b {
+        row = fmt.Sprintf("row %d (remote row %d)", a+1, b+1)
+    }
+
+    var out strings.Builder
+    for j := 0; j < len(localRow) || j < len(remoteRow); j++ {
+        localField, remoteField := "", ""
+        if j < len(localRow) {
+            localField = localRow[j]
+        }
+        if j < len(remoteRow) {
+            remoteField = remoteRow[j]
+        }
+        if localField != remoteField {
+            out.WriteString(r.field(row, fmt.Sprintf("col %d", j+1), field(header, j), localField, remoteField))
+        }
+    }
+    return out.String()
+}
+
+// rowsRelated reports whether at least half of the fields of the wider row
+// are unchanged, which is when a delete+insert reads better as an edit.
+func rowsRelated(localRow, remoteRow []string) bool {
+    width := len(localRow)
+    if len(remoteRow) > width {
+        width = len(remoteRow)
+    }
+    same := 0
+    for j := 0; j < len(localRow) && j < len(remoteRow); j++ {
+        if localRow[j] == remoteRow[j] {
+            same++
+        }
+    }
+    return width > 0 && 2*same >= width
+}
+
+func rowKeys(rows [][]string) []string {
+    keys := make([]string, len(rows))
+    for i, row := range rows {
+        keys[i] = strings.Join(row, "\x00")
+    }
+    return keys
+}
+
+// alignRows computes a shortest edit script from a to b. The common prefix
+// and suffix are matched directly and the Myers search only runs over the
+// rows between them. aligned is false when the search gave up at
+// maxAlignCost.
+func alignRows(a, b []string) (edits []rowEdit, aligned bool) {
+    pre := 0
+    for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+        pre++
+    }
+    suf := 0
+    for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+        suf++
+    }
+
+    for i := 0; i < pre; i++ {
+        edits = append(edits, rowEdit{Op: '=', A: i, B: i})
+    }
+    mid, aligned := myersDiff(a[pre:len(a)-suf], b[pre:len(b)-suf])
+    for _, e := range mid {
+        if e.A >= 0 {
+            e.A += pre
+        }
+        if e.B >= 0 {
+            e.B += pre
+        }
+        edits = append(edits, e)
+    }
+    for i := suf; i > 0; i-- {
+        edits = append(edits, rowEdit{Op: '=', A: len(a) - i, B: len(b) - i})
+    }
+    return edits, aligned
+}
+
+func myersDiff(a, b []string) ([]rowEdit, bool) {
+    n, m := len(a), len(b)
+    max := n + m
+    off := max + 1
+    v := make([]int, 2*max+3)
+    var trace [][]int
+
+    for d := 0; d <= max; d++ {
+        if d > maxAlignCost {
+            return replaceRows(n, m), false
+        }
+        for k := -d; k <= d; k += 2 {
+            var x int
+            if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+                x = v[off+k+1]
+            } else {
+                x = v[off+k-1] + 1
+            }
+            y := x - k
+            for x < n && y < m && a[x] == b[y] {
+                x++
+                y++
+            }
+            v[off+k] = x
+            if x >= n && y >= m {
+                return backtrackEdits(trace, n, m), true
+            }
+        }
+        trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+    }
+    return nil, true
+}
+
+// backtrackEdits walks the saved frontier of each step d (trace[d], indexed
+// from diagonal -d) back from (n, m) to recover the edit script.
+func backtrackEdits(trace [][]int, n, m int) []rowEdit {
+    var rev []rowEdit
+    x, y := n, m
+    for d := len(trace); d > 0; d-- {
+        prev := trace[d-1]
+        at := func(k int) int { return prev[k+d-1] }
+        k := x - y
+        var prevK int
+        if k == -d || (k != d && at(k-1) < at(k+1)) {
+            prevK = k + 1
+        } else {
+            prevK = k - 1
+        }
+        prevX := at(prevK)
+        prevY := prevX - prevK
+        for x > prevX && y > prevY {
+            x--
+            y--
+            rev = append(rev, rowEdit{Op: '=', A: x, B: y})
+        }
+        if x == prevX {
+            rev = append(rev, rowEdit{Op: '+', A: -1, B: prevY})
+        } else {
+            rev = append(rev, rowEdit{Op: '-', A: prevX, B: -1})
+        }
+        x, y = prevX, prevY
+    }
+    for x > 0 && y > 0 {
+        x--
+        y--
+        rev = append(rev, rowEdit{Op: '=', A: x, B: y})
+    }
+
+    edits := make([]rowEdit, len(rev))
+    for i, e := range rev {
+        edits[len(rev)-1-i] = e
+    }
+    return edits
+}
+
+func replaceRows(n, m int) []rowEdit {
+    edits := make([]rowEdit, 0, n+m)
+    for i := 0; i < n; i++ {
+        edits = append(edits, rowEdit{Op: '-', A: i, B: -1})
+    }
+    for j := 0; j < m; j++ {
+        edits = append(edits, rowEdit{Op: '+', A: -1, B: j})
+    }
+    return edits
+}
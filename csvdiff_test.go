@@ -0,0 +1,202 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func rowsOf(s string) []string {
+    if s == "" {
+        return nil
+    }
+    return strings.Split(s, "")
+}
+
+// editCost checks that edits turn a into b, visiting every row of each side
+// once and in order, and returns the number of inserts and deletes.
+func editCost(t *testing.T, a, b []string, edits []rowEdit) int {
+    t.Helper()
+    i, j, cost := 0, 0, 0
+    for _, e := range edits {
+        switch e.Op {
+        case '=':
+            if e.A != i || e.B != j || a[i] != b[j] {
+                t.Fatalf("bad match %+v at a[%d], b[%d] in %v", e, i, j, edits)
+            }
+            i++
+            j++
+        case '-':
+            if e.A != i || e.B != -1 {
+                t.Fatalf("bad delete %+v at a[%d] in %v", e, i, edits)
+            }
+            i++
+            cost++
+        case '+':
+            if e.A != -1 || e.B != j {
+                t.Fatalf("bad insert %+v at b[%d] in %v", e, j, edits)
+            }
+            j++
+            cost++
+        default:
+            t.Fatalf("unknown op %q in %v", e.Op, edits)
+        }
+    }
+    if i != len(a) || j != len(b) {
+        t.Fatalf("edits cover %d of %d local and %d of %d remote rows", i, len(a), j, len(b))
+    }
+    return cost
+}
+
+// lcsCost is the shortest edit script length by dynamic programming.
+func lcsCost(a, b []string) int {
+    l := make([][]int, len(a)+1)
+    for i := range l {
+        l[i] = make([]int, len(b)+1)
+    }
+    for i := len(a) - 1; i >= 0; i-- {
+        for j := len(b) - 1; j >= 0; j-- {
+            switch {
+            case a[i] == b[j]:
+                l[i][j] = l[i+1][j+1] + 1
+            case l[i+1][j] > l[i][j+1]:
+                l[i][j] = l[i+1][j]
+            default:
+                l[i][j] = l[i][j+1]
+            }
+        }
+    }
+    return len(a) + len(b) - 2*l[0][0]
+}
+
+func TestAlignRowsShortest(t *testing.T) {
+    tests := []struct {
+        a, b string
+        cost int
+    }{
+        {"", "", 0},
+        {"", "abc", 3},
+        {"abc", "", 3},
+        {"abc", "abc", 0},
+        {"abc", "abxc", 1},
+        {"abxc", "abc", 1},
+        {"abc", "xabc", 1},
+        {"abc", "abcx", 1},
+        {"abc", "xyz", 6},
+        {"abcabba", "cbabac", 5},
+        {"aaaa", "aa", 2},
+        {"abab", "baba", 2},
+        {"abcdef", "acbdfe", 4},
+        {"xaby", "xbay", 2},
+    }
+    for _, tt := range tests {
+        a, b := rowsOf(tt.a), rowsOf(tt.b)
+        for _, fn := range []struct {
+            name  string
+            align func(a, b []string) ([]rowEdit, bool)
+        }{{"alignRows", alignRows}, {"myersDiff", myersDiff}} {
+            edits, aligned := fn.align(a, b)
+            if !aligned {
+                t.Errorf("%s(%q, %q) gave up", fn.name, tt.a, tt.b)
+                continue
+            }
+            if got := editCost(t, a, b, edits); got != tt.cost || got != lcsCost(a, b) {
+                t.Errorf("%s(%q, %q) cost %d, want %d", fn.name, tt.a, tt.b, got, tt.cost)
+            }
+        }
+    }
+}
+
+func TestAlignRowsEdits(t *testing.T) {
+    tests := []struct {
+        name  string
+        a, b  string
+        edits []rowEdit
+    }{
+        {"both empty", "", "", nil},
+        {"all inserted", "", "ab", []rowEdit{{'+', -1, 0}, {'+', -1, 1}}},
+        {"all deleted", "ab", "", []rowEdit{{'-', 0, -1}, {'-', 1, -1}}},
+        {"insert in the middle", "ac", "abc", []rowEdit{{'=', 0, 0}, {'+', -1, 1}, {'=', 1, 2}}},
+        {"delete in the middle", "abc", "ac", []rowEdit{{'=', 0, 0}, {'-', 1, -1}, {'=', 2, 1}}},
+        {"replace in the middle", "abc", "axc", []rowEdit{{'=', 0, 0}, {'-', 1, -1}, {'+', -1, 1}, {'=', 2, 2}}},
+        // The prefix takes every repeated row it can, so the deletion lands
+        // on the last copy.
+        {"repeated rows", "aaa", "aa", []rowEdit{{'=', 0, 0}, {'=', 1, 1}, {'-', 2, -1}}},
+        {"appended", "ab", "abcd", []rowEdit{{'=', 0, 0}, {'=', 1, 1}, {'+', -1, 2}, {'+', -1, 3}}},
+        {"prepended", "ab", "xab", []rowEdit{{'+', -1, 0}, {'=', 0, 1}, {'=', 1, 2}}},
+    }
+    for _, tt := range tests {
+        edits, aligned := alignRows(rowsOf(tt.a), rowsOf(tt.b))
+        if !aligned {
+            t.Errorf("%s: gave up", tt.name)
+        }
+        if !reflect.DeepEqual(edits, tt.edits) {
+            t.Errorf("%s: edits %v, want %v", tt.name, edits, tt.edits)
+        }
+    }
+}
+
+func TestBacktrackEditsNoSteps(t *testing.T) {
+    // With no saved frontiers the whole diagonal back to (0, 0) is a match.
+    want := []rowEdit{{'=', 0, 0}, {'=', 1, 1}, {'=', 2, 2}}
+    if got := backtrackEdits(nil, 3, 3); !reflect.DeepEqual(got, want) {
+        t.Errorf("edits %v, want %v", got, want)
+    }
+    if got := backtrackEdits(nil, 0, 0); len(got) != 0 {
+        t.Errorf("edits %v, want none", got)
+    }
+}
+
+func distinctRows(prefix string, n int) []string {
+    rows := make([]string, n)
+    for i := range rows {
+        rows[i] = fmt.Sprintf("%s%d", prefix, i)
+    }
+    return rows
+}
+
+func TestAlignRowsCostLimit(t *testing.T) {
+    head, tail := []string{"header"}, []string{"footer"}
+    wrap := func(mid []string) []string {
+        return append(append(append([]string(nil), head...), mid...), tail...)
+    }
+
+    // Exactly maxAlignCost edits still aligns.
+    a, b := wrap(distinctRows("a", maxAlignCost/2)), wrap(distinctRows("b", maxAlignCost/2))
+    edits, aligned := alignRows(a, b)
+    if !aligned {
+        t.Fatal("gave up at maxAlignCost edits")
+    }
+    if got := editCost(t, a, b, edits); got != maxAlignCost {
+        t.Errorf("cost %d, want %d", got, maxAlignCost)
+    }
+
+    // One row more and the middle is replaced wholesale, with the common
+    // prefix and suffix still matched.
+    n := maxAlignCost/2 + 1
+    a, b = wrap(distinctRows("a", n)), wrap(distinctRows("b", n))
+    edits, aligned = alignRows(a, b)
+    if aligned {
+        t.Fatal("aligned past maxAlignCost")
+    }
+    want := []rowEdit{{'=', 0, 0}}
+    for _, e := range replaceRows(n, n) {
+        if e.A >= 0 {
+            e.A++
+        }
+        if e.B >= 0 {
+            e.B++
+        }
+        want = append(want, e)
+    }
+    want = append(want, rowEdit{'=', n + 1, n + 1})
+    if !reflect.DeepEqual(edits, want) {
+        t.Errorf("fallback edits differ from prefix + replaced middle + suffix")
+    }
+    editCost(t, a, b, edits)
+
+    if edits, aligned := myersDiff(distinctRows("a", n), distinctRows("b", n)); aligned || !reflect.DeepEqual(edits, replaceRows(n, n)) {
+        t.Errorf("myersDiff past maxAlignCost: aligned %v, %d edits", aligned, len(edits))
+    }
+}
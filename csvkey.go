@@ -0,0 +1,231 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// keyedRows indexes the data rows of a table (header excluded) by the
+// values of its key columns, rendered as "ID=3" or "Date=2020-12-12, Symbol=c".
+// The second and later rows sharing a key get a " #n" suffix so every row
+// stays addressable.
+type keyedRows struct {
+    keys  []string
+    index map[string]int
+    dups  []string
+}
+
+func indexRows(rows [][]string, names []string, cols []int) keyedRows {
+    k := keyedRows{index: make(map[string]int, len(rows))}
+    seen := map[string]int{}
+    for i, row := range rows {
+        parts := make([]string, len(cols))
+        for c, col := range cols {
+            parts[c] = names[c] + "=" + field(row, col)
+        }
+        key := strings.Join(parts, ", ")
+        if n := seen[key]; n > 0 {
+            if n == 1 {
+                k.dups = append(k.dups, key)
+            }
+            seen[key]++
+            key = fmt.Sprintf("%s #%d", key, n+1)
+        } else {
+            seen[key] = 1
+        }
+        k.keys = append(k.keys, key)
+        k.index[key] = i
+    }
+    return k
+}
+
+func field(row []string, col int) string {
+    if col < len(row) {
+        return row[col]
+    }
+    return ""
+}
+
+func headerIndex(header []string, name string) int {
+    for i, h := range header {
+        if strings.TrimSpace(h) == name {
+            return i
+        }
+    }
+    return -1
+}
+
+func keyColumns(header, key []string) ([]int, error) {
+    cols := make([]int, len(key))
+    for i, name := range key {
+        if cols[i] = headerIndex(header, name); cols[i] < 0 {
+            return nil, fmt.Errorf("no %q column", name)
+        }
+    }
+    return cols, nil
+}
+
+// diffKeyedRows matches rows by their key columns and columns by header
+// name, so inserted, sorted or reshuffled rows and reordered columns do not
+// show up as modifications. The first row of each table is the header.
+func diffKeyedRows(r *csvReport, localCSV, remoteCSV [][]string, key []string) error {
+    if len(localCSV) == 0 || len(remoteCSV) == 0 {
+        return fmt.Errorf("missing header row")
+    }
+    localHeader, remoteHeader := localCSV[0], remoteCSV[0]
+    localKey, err := keyColumns(localHeader, key)
+    if err != nil {
+        return fmt.Errorf("local: %v", err)
+    }
+    remoteKey, err := keyColumns(remoteHeader, key)
+    if err != nil {
+        return fmt.Errorf("remote: %v", err)
+    }
+    localRows := indexRows(localCSV[1:], key, localKey)
+    remoteRows := indexRows(remoteCSV[1:], key, remoteKey)
+    for _, k := range localRows.dups {
+        r.note(fmt.Sprintf("Duplicate key in local rows: %s\n", k))
+    }
+    for _, k := range remoteRows.dups {
+        r.note(fmt.Sprintf("Duplicate key in remote rows: %s\n", k))
+    }
+
+    var common [][2]int
+    var localOrder, remoteOrder []string
+    for i, k := range localRows.keys {
+        if j, ok := remoteRows.index[k]; ok {
+            common = append(common, [2]int{i + 1, j + 1})
+            localOrder = append(localOrder, k)
+        }
+    }
+    for _, k := range remoteRows.keys {
+        if _, ok := localRows.index[k]; ok {
+            remoteOrder = append(remoteOrder, k)
+        }
+    }
+
+    columns := matchColumns(r, localCSV, remoteCSV, common)
+
+    // Rows present on both sides that fall outside the longest common
+    // subsequence of keys changed position relative to the others.
+    moved := map[string]bool{}
+    edits, aligned := alignRows(localOrder, remoteOrder)
+    if !aligned {
+        r.note("Row order changed too much to identify moved rows\n")
+    } else {
+        for _, e := range edits {
+            if e.Op == '-' {
+                moved[localOrder[e.A]] = true
+            }
+        }
+    }
+
+    for i, k := range localRows.keys {
+        localRow := localCSV[i+1]
+        j, ok := remoteRows.index[k]
+        if !ok {
+            r.change(fmt.Sprintf("Omitted row %d (%s): %s\n", i+2, k, strings.Join(localRow, ",")))
+            continue
+        }
+        if moved[k] {
+            r.change(fmt.Sprintf("Moved row (%s): row %d → row %d\n", k, i+2, j+2))
+        }
+        remoteRow := remoteCSV[j+1]
+        where := fmt.Sprintf("row %d (%s)", i+2, k)
+        var mods strings.Builder
+        for _, c := range columns {
+            if localField, remoteField := field(localRow, c.Local), field(remoteRow, c.Remote); localField != remoteField {
+                mods.WriteString(r.field(where, fmt.Sprintf("column '%s'", c.Name), c.Name, localField, remoteField))
+            }
+        }
+        if mods.Len() > 0 {
+            r.change(mods.String())
+        }
+    }
+    for j, k := range remoteRows.keys {
+        if _, ok := localRows.index[k]; !ok {
+            r.change(fmt.Sprintf("Added row %d (%s): %s\n", j+2, k, strings.Join(remoteCSV[j+1], ",")))
+        }
+    }
+    return nil
+}
+
+type columnPair struct {
+    Local, Remote int
+    Name          string
+}
+
+// matchColumns pairs local and remote columns by header name. A leftover
+// local column is taken to be renamed when a leftover remote column holds
+// the same value in at least half of the common rows; otherwise it was
+// dropped. Findings about the header are reported as notes and the pairs
+// are returned in local order.
+func matchColumns(r *csvReport, localCSV, remoteCSV [][]string, common [][2]int) []columnPair {
+    localHeader, remoteHeader := localCSV[0], remoteCSV[0]
+    used := make([]bool, len(remoteHeader))
+    remoteOf := make([]int, len(localHeader))
+    for i, name := range localHeader {
+        remoteOf[i] = -1
+        if j := headerIndex(remoteHeader, strings.TrimSpace(name)); j >= 0 && !used[j] {
+            remoteOf[i] = j
+            used[j] = true
+        }
+    }
+
+    for i := range localHeader {
+        if remoteOf[i] >= 0 {
+            continue
+        }
+        best, bestSame := -1, 0
+        for j := range remoteHeader {
+            if used[j] {
+                continue
+            }
+            same := 0
+            for _, rows := range common {
+                if v := field(localCSV[rows[0]], i); v != "" && v == field(remoteCSV[rows[1]], j) {
+                    same++
+                }
+            }
+            if same > bestSame {
+                best, bestSame = j, same
+            }
+        }
+        if best >= 0 && 2*bestSame >= len(common) {
+            remoteOf[i] = best
+            used[best] = true
+            r.note(fmt.Sprintf("Column renamed: '%s' → '%s'\n", localHeader[i], remoteHeader[best]))
+        } else {
+            r.note(fmt.Sprintf("Column dropped: '%s'\n", localHeader[i]))
+        }
+    }
+    for j, name := range remoteHeader {
+        if !used[j] {
+            r.note(fmt.Sprintf("Column added: '%s'\n", name))
+        }
+    }
+
+    var pairs []columnPair
+    var localNames []string
+    for i, j := range remoteOf {
+        if j >= 0 {
+            pairs = append(pairs, columnPair{Local: i, Remote: j, Name: localHeader[i]})
+            localNames = append(localNames, localHeader[i])
+        }
+    }
+    var remoteNames []string
+    for j, name := range remoteHeader {
+        for _, p := range pairs {
+            if p.Remote == j {
+                remoteNames = append(remoteNames, name)
+            }
+        }
+    }
+    for n := 1; n < len(pairs); n++ {
+        if pairs[n].Remote < pairs[n-1].Remote {
+            r.note(fmt.Sprintf("Columns reordered: %s → %s\n", strings.Join(localNames, ","), strings.Join(remoteNames, ",")))
+            break
+        }
+    }
+    return pairs
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func table(lines ...string) [][]string {
+    rows := make([][]string, len(lines))
+    for i, line := range lines {
+        rows[i] = strings.Split(line, ",")
+    }
+    return rows
+}
+
+func keyedDiff(local, remote [][]string, key ...string) ([]string, error) {
+    r := &csvReport{max: 100, tolerance: func(string) ToleranceConfig { return ToleranceConfig{} }}
+    err := diffKeyedRows(r, local, remote, key)
+    out := strings.TrimSuffix(r.out.String(), "\n")
+    if out == "" {
+        return nil, err
+    }
+    return strings.Split(out, "\n"), err
+}
+
+func TestDiffKeyedRows(t *testing.T) {
+    base := table("ID,Name,Value", "1,one,10", "2,two,20", "3,three,30")
+    tests := []struct {
+        name   string
+        local  [][]string
+        remote [][]string
+        key    []string
+        want   []string
+    }{
+        {"unchanged", base, base, []string{"ID"}, nil},
+        {"reordered rows", base, table("ID,Name,Value", "3,three,30", "1,one,10", "2,two,20"), []string{"ID"}, []string{
+            "Moved row (ID=3): row 4 → row 2",
+        }},
+        {"reordered rows and columns", base, table("Value,ID,Name", "20,2,two", "10,1,one", "30,3,three"), []string{"ID"}, []string{
+            "Columns reordered: ID,Name,Value → Value,ID,Name",
+            "Moved row (ID=1): row 2 → row 3",
+        }},
+        {"added key", base, table("ID,Name,Value", "1,one,10", "2,two,20", "4,four,40", "3,three,30"), []string{"ID"}, []string{
+            "Added row 4 (ID=4): 4,four,40",
+        }},
+        {"removed key", base, table("ID,Name,Value", "1,one,10", "3,three,30"), []string{"ID"}, []string{
+            "Omitted row 3 (ID=2): 2,two,20",
+        }},
+        {"changed key", base, table("ID,Name,Value", "1,one,10", "5,two,20", "3,three,30"), []string{"ID"}, []string{
+            "Omitted row 3 (ID=2): 2,two,20",
+            "Added row 3 (ID=5): 5,two,20",
+        }},
+        {"changed values", base, table("ID,Name,Value", "1,one,10", "2,deux,20", "3,three,31"), []string{"ID"}, []string{
+            "Modified field in row 3 (ID=2), column 'Name': 'two' → 'deux'",
+            "Modified field in row 4 (ID=3), column 'Value': '30' → '31' (Δ +1, +3.33%)",
+        }},
+        {"composite key", table("Date,Symbol,Close", "d1,a,1", "d1,b,2"), table("Date,Symbol,Close", "d1,b,2", "d1,a,3"), []string{"Date", "Symbol"}, []string{
+            "Moved row (Date=d1, Symbol=a): row 2 → row 3",
+            "Modified field in row 2 (Date=d1, Symbol=a), column 'Close': '1' → '3' (Δ +2, +200%)",
+        }},
+        {"duplicate remote key", base, table("ID,Name,Value", "1,one,10", "2,two,20", "2,two again,21", "3,three,30"), []string{"ID"}, []string{
+            "Duplicate key in remote rows: ID=2",
+            "Added row 4 (ID=2 #2): 2,two again,21",
+        }},
+        {"duplicate key on both sides", table("ID,Name", "1,a", "1,b"), table("ID,Name", "1,a", "1,c"), []string{"ID"}, []string{
+            "Duplicate key in local rows: ID=1",
+            "Duplicate key in remote rows: ID=1",
+            "Modified field in row 3 (ID=1 #2), column 'Name': 'b' → 'c'",
+        }},
+        {"renamed column", base, table("ID,Label,Value", "1,one,10", "2,two,20", "3,three,30"), []string{"ID"}, []string{
+            "Column renamed: 'Name' → 'Label'",
+        }},
+    }
+    for _, tt := range tests {
+        got, err := keyedDiff(tt.local, tt.remote, tt.key...)
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+            t.Errorf("%s: diff\n  %s\nwant\n  %s", tt.name, strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+        }
+    }
+}
+
+func TestDiffKeyedRowsUnusableKey(t *testing.T) {
+    base := table("ID,Name", "1,a")
+    tests := []struct {
+        name          string
+        local, remote [][]string
+        key           []string
+        err           string
+    }{
+        {"key missing locally", table("Name", "a"), base, []string{"ID"}, `local: no "ID" column`},
+        {"key missing remotely", base, table("Name", "a"), []string{"ID"}, `remote: no "ID" column`},
+        {"part of a composite key missing", base, base, []string{"ID", "Date"}, `local: no "Date" column`},
+        {"empty table", nil, base, []string{"ID"}, "missing header row"},
+    }
+    for _, tt := range tests {
+        if _, err := keyedDiff(tt.local, tt.remote, tt.key...); err == nil || err.Error() != tt.err {
+            t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+        }
+    }
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+)
+
+// csvTable is a leniently parsed CSV file together with what the parser
+// had to tolerate to read it.
+type csvTable struct {
+    Rows       [][]string
+    Fields     []int // field count of each row before overflow was folded
+    Quoted     int   // fields wrapped in double quotes
+    BareQuotes []int // 1-based rows with a quote inside an unquoted field
+    Unclosed   int   // 1-based row where an unterminated quote starts, or 0
+    CRLF       bool
+}
+
+// readTable parses a file the way its table settings ask for. Only
+// fixed-width tables have a preamble.
+func readTable(opts *CSVDiffConfig, filename string, data []byte) (rows [][]string, preamble []string, err error) {
+    if t := opts.table(filename); t != nil && t.Format == "fixed" {
+        fixed, err := parseFixedWidth(data, t.Columns)
+        if err != nil {
+            return nil, nil, err
+        }
+        return fixed.Rows, fixed.Preamble, nil
+    }
+    if opts.parseMode(filename) == "lenient" {
+        return parseLenientCSV(data).Rows, nil, nil
+    }
+    rows, err = parseCSVFromBytes(data)
+    return rows, nil, err
+}
+
+// parseLenientCSV reads CSV the way it is often written by hand: quotes are
+// only special at the start of a field, and a row with more fields than the
+// header has its overflow folded back into the last column, since that is
+// where unquoted commas in free-text fields end up. Rows with fewer fields
+// are kept short.
+func parseLenientCSV(data []byte) *csvTable {
+    t := &csvTable{CRLF: bytes.Contains(data, []byte("\r\n"))}
+    text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+    var row []string
+    var f strings.Builder
+    inQuotes, quoted, fieldStart := false, false, true
+    endField := func() {
+        row = append(row, f.String())
+        f.Reset()
+        quoted, fieldStart = false, true
+    }
+    endRow := func() {
+        endField()
+        if len(row) > 1 || row[0] != "" || quoted {
+            t.add(row)
+        }
+        row = nil
+    }
+
+    for i := 0; i < len(text); i++ {
+        c := text[i]
+        switch {
+        case inQuotes:
+            if c != '"' {
+                f.WriteByte(c)
+            } else if i+1 < len(text) && text[i+1] == '"' {
+                f.WriteByte('"')
+                i++
+            } else {
+                inQuotes = false
+                if i+1 < len(text) && text[i+1] != ',' && text[i+1] != '\n' {
+                    t.bareQuote()
+                }
+            }
+        case c == '"' && fieldStart:
+            inQuotes, quoted, fieldStart = true, true, false
+            t.Quoted++
+        case c == ',':
+            endField()
+        case c == '\n':
+            endRow()
+        default:
+            if c == '"' {
+                t.bareQuote()
+            }
+            f.WriteByte(c)
+            fieldStart = false
+        }
+    }
+    if inQuotes {
+        t.Unclosed = len(t.Rows) + 1
+    }
+    if len(row) > 0 || f.Len() > 0 || quoted {
+        endRow()
+    }
+    return t
+}
+
+// bareQuote records a quote in the middle of a field, or text after a
+// closing quote, in the row being read.
+func (t *csvTable) bareQuote() {
+    if n := len(t.Rows) + 1; len(t.BareQuotes) == 0 || t.BareQuotes[len(t.BareQuotes)-1] != n {
+        t.BareQuotes = append(t.BareQuotes, n)
+    }
+}
+
+func (t *csvTable) add(row []string) {
+    t.Fields = append(t.Fields, len(row))
+    if len(t.Rows) > 0 {
+        if width := len(t.Rows[0]); width > 0 && len(row) > width {
+            row = append(row[:width-1:width-1], strings.Join(row[width-1:], ","))
+        }
+    }
+    t.Rows = append(t.Rows, row)
+}
+
+// compareStructure reports how the shape of the file changed, separately
+// from what its values say: rows whose field count no longer matches the
+// header, quoting, stray quotes and line endings.
+func compareStructure(local, remote *csvTable) []string {
+    var out []string
+    // Appended or removed rows alone change the histogram, and edited values
+    // change which ragged rows look new; only report it when the header
+    // width or the field counts of the ragged rows changed.
+    if headerWidth(local) != headerWidth(remote) || !sameCounts(raggedCounts(local), raggedCounts(remote)) {
+        out = append(out, fmt.Sprintf("Field counts changed: local %s → remote %s", fieldCounts(local), fieldCounts(remote)))
+        if rows := raggedRows(remote, local); len(rows) > 0 {
+            out = append(out, fmt.Sprintf("New remote rows without the header's %d fields: %s", remote.Fields[0], rowList(rows)))
+        }
+    }
+    if local.Quoted != remote.Quoted {
+        out = append(out, fmt.Sprintf("Quoted fields: local %d → remote %d", local.Quoted, remote.Quoted))
+    }
+    if len(local.BareQuotes) != len(remote.BareQuotes) {
+        out = append(out, fmt.Sprintf("Rows with bare quotes: local %d → remote %d", len(local.BareQuotes), len(remote.BareQuotes)))
+        if len(remote.BareQuotes) > 0 {
+            out = append(out, "Remote rows with bare quotes: "+rowList(remote.BareQuotes))
+        }
+    }
+    if remote.Unclosed > 0 && local.Unclosed == 0 {
+        out = append(out, fmt.Sprintf("Remote has an unterminated quote starting in row %d", remote.Unclosed))
+    }
+    if local.CRLF != remote.CRLF {
+        out = append(out, fmt.Sprintf("Line endings changed: %s → %s", lineEnding(local.CRLF), lineEnding(remote.CRLF)))
+    }
+    return out
+}
+
+// fieldCounts summarises rows by field count, most common first, e.g.
+// "5 fields × 97, 6 fields × 2".
+func fieldCounts(t *csvTable) string {
+    hist := map[int]int{}
+    for _, n := range t.Fields {
+        hist[n]++
+    }
+    counts := make([]int, 0, len(hist))
+    for n := range hist {
+        counts = append(counts, n)
+    }
+    sort.Slice(counts, func(i, j int) bool {
+        if hist[counts[i]] != hist[counts[j]] {
+            return hist[counts[i]] > hist[counts[j]]
+        }
+        return counts[i] < counts[j]
+    })
+    parts := make([]string, len(counts))
+    for i, n := range counts {
+        parts[i] = fmt.Sprintf("%d fields × %d", n, hist[n])
+    }
+    return strings.Join(parts, ", ")
+}
+
+func headerWidth(t *csvTable) int {
+    if len(t.Fields) == 0 {
+        return 0
+    }
+    return t.Fields[0]
+}
+
+// raggedCounts counts the rows of t by field count, leaving out rows that
+// match the header's.
+func raggedCounts(t *csvTable) map[int]int {
+    counts := map[int]int{}
+    for _, n := range t.Fields {
+        if n != headerWidth(t) {
+            counts[n]++
+        }
+    }
+    return counts
+}
+
+func sameCounts(a, b map[int]int) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for n, count := range a {
+        if b[n] != count {
+            return false
+        }
+    }
+    return true
+}
+
+// raggedRows returns the rows of t whose field count differs from its
+// header's, leaving out rows that also appear in base.
+func raggedRows(t, base *csvTable) []int {
+    known := map[string]bool{}
+    for _, key := range rowKeys(base.Rows) {
+        known[key] = true
+    }
+    var rows []int
+    for i, key := range rowKeys(t.Rows) {
+        if t.Fields[i] != t.Fields[0] && !known[key] {
+            rows = append(rows, i+1)
+        }
+    }
+    return rows
+}
+
+func rowList(rows []int) string {
+    const shown = 10
+    parts := []string{}
+    for i, n := range rows {
+        if i == shown {
+            parts = append(parts, fmt.Sprintf("and %d more", len(rows)-shown))
+            break
+        }
+        parts = append(parts, fmt.Sprint(n))
+    }
+    return strings.Join(parts, ", ")
+}
+
+func lineEnding(crlf bool) string {
+    if crlf {
+        return "CRLF"
+    }
+    return "LF"
+}
+
+// csvFindings returns the findings about a changed CSV file that are logged
+// apart from its diff: structural anomalies and schema drift against the
+// baseline version baselineHash, whose content is at basePath.
+func csvFindings(ws *WatchSet, schemas *schemaStore, filename, baselineHash, basePath string, body []byte, ts string) []shiftEntry {
+    localData, err := os.ReadFile(basePath)
+    if err != nil {
+        return nil
+    }
+    var entries []shiftEntry
+    if text := seriesFinding(ws, filename, localData, body, ts); text != "" {
+        entries = append(entries, shiftEntry{File: filename, Kind: "summary", Text: text})
+    }
+    if lines := schemas.drift(ws, filename, baselineHash, localData, body); len(lines) > 0 {
+        text := fmt.Sprintf("[%s] %s: Schema drift\n%s\n", ts, filename, strings.Join(lines, "\n"))
+        entries = append(entries, shiftEntry{File: filename, Kind: "schema", Text: text})
+    }
+    if t := ws.Diff.CSV.table(filename); t != nil && t.Format == "fixed" {
+        return entries
+    }
+    if lines := compareStructure(parseLenientCSV(localData), parseLenientCSV(body)); len(lines) > 0 {
+        text := fmt.Sprintf("[%s] %s: Structural anomalies\n%s\n", ts, filename, strings.Join(lines, "\n"))
+        entries = append(entries, shiftEntry{File: filename, Kind: "structure", Text: text})
+    }
+    return entries
+}
+
+// seriesFinding summarises a time-series table as a whole. It is logged apart
+// from the row diff so the truncated diff text is left for the row changes.
+func seriesFinding(ws *WatchSet, filename string, localData, remoteData []byte, ts string) string {
+    table := ws.Diff.CSV.table(filename)
+    if table == nil || table.TimeColumn == "" {
+        return ""
+    }
+    localCSV, _, err := readTable(&ws.Diff.CSV, filename, localData)
+    if err != nil {
+        return ""
+    }
+    remoteCSV, _, err := readTable(&ws.Diff.CSV, filename, remoteData)
+    if err != nil {
+        return ""
+    }
+    lines, err := seriesSummary(localCSV, remoteCSV, table.TimeColumn)
+    if err != nil {
+        return fmt.Sprintf("[%s] %s: Series summary unavailable: %v\n", ts, filename, err)
+    }
+    return fmt.Sprintf("[%s] %s: Series summary (%s)\n  %s\n", ts, filename, table.TimeColumn, strings.Join(lines, "\n  "))
+}
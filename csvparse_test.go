@@ -0,0 +1,40 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestCompareStructure(t *testing.T) {
+    const base = "a,b,c\n1,2,3\n4,5,6,7,8\n9,10\n"
+    tests := []struct {
+        name   string
+        remote string
+        want   []string // prefixes of the expected findings, in order
+    }{
+        {"unchanged", base, nil},
+        {"value edited in a regular row", "a,b,c\n1,20,3\n4,5,6,7,8\n9,10\n", nil},
+        {"value edited in a ragged row", "a,b,c\n1,2,3\n4,50,6,7,8\n9,10\n", nil},
+        {"regular row appended", base + "11,12,13\n", nil},
+        {"ragged row appended", base + "11,12\n", []string{"Field counts changed", "New remote rows without the header's 3 fields: 5"}},
+        {"ragged row fixed", "a,b,c\n1,2,3\n4,5,6\n9,10\n", []string{"Field counts changed"}},
+        {"header widened", "a,b,c,d\n1,2,3\n4,5,6,7,8\n9,10\n", []string{"Field counts changed", "New remote rows"}},
+        {"quoting added", "a,b,c\n\"1\",2,3\n4,5,6,7,8\n9,10\n", []string{"Quoted fields: local 0 → remote 1"}},
+        {"bare quote", "a,b,c\n1,2\"x,3\n4,5,6,7,8\n9,10\n", []string{"Rows with bare quotes: local 0 → remote 1", "Remote rows with bare quotes: 2"}},
+        {"unterminated quote", base + "\"11,12,13\n", []string{"Field counts changed", "New remote rows", "Quoted fields", "Remote has an unterminated quote starting in row 5"}},
+        {"line endings", strings.ReplaceAll(base, "\n", "\r\n"), []string{"Line endings changed"}},
+    }
+    local := parseLenientCSV([]byte(base))
+    for _, tt := range tests {
+        got := compareStructure(local, parseLenientCSV([]byte(tt.remote)))
+        if len(got) != len(tt.want) {
+            t.Errorf("%s: findings %q, want %d", tt.name, got, len(tt.want))
+            continue
+        }
+        for i, prefix := range tt.want {
+            if !strings.HasPrefix(got[i], prefix) {
+                t.Errorf("%s: finding %q, want prefix %q", tt.name, got[i], prefix)
+            }
+        }
+    }
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/rand"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+type fetchOutcome struct {
+    Remote   *remoteFile
+    Err      error
+    Attempts int
+}
+
+type tooLargeError struct {
+    Size  int64
+    Limit int64
+}
+
+func (e *tooLargeError) Error() string {
+    return fmt.Sprintf("%d bytes exceeds the %d byte limit", e.Size, e.Limit)
+}
+
+// fetchStatus classifies a fetch error as the per-file status recorded in the
+// log, index and receipt.
+func fetchStatus(err error) string {
+    var tooLarge *tooLargeError
+    var netErr net.Error
+    switch {
+    case errors.As(err, &tooLarge):
+        return "too-large"
+    case errors.Is(err, context.DeadlineExceeded):
+        return "timeout"
+    case errors.As(err, &netErr) && netErr.Timeout():
+        return "timeout"
+    }
+    return "unreachable"
+}
+
+func (o fetchOutcome) attemptsDetail() string {
+    if o.Attempts > 1 {
+        return fmt.Sprintf(" after %d attempts", o.Attempts)
+    }
+    return ""
+}
+
+func retryableStatus(code int) bool {
+    switch code {
+    case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+        http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+        return true
+    }
+    return false
+}
+
+// parseRetryAfter accepts both forms of Retry-After: delay-seconds and an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+    if value == "" {
+        return 0
+    }
+    if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs >= 0 {
+        return time.Duration(secs) * time.Second
+    }
+    if t, err := http.ParseTime(value); err == nil {
+        return time.Until(t)
+    }
+    return 0
+}
+
+// backoff returns how long to wait before retry number attempt: exponential
+// from cfg.Backoff with equal jitter, or the server's Retry-After for 429 and
+// 503, both capped at cfg.MaxBackoff.
+func (p *fetchPipeline) backoff(attempt int, remote *remoteFile) time.Duration {
+    base, limit := time.Duration(p.cfg.Backoff), time.Duration(p.cfg.MaxBackoff)
+    d := base << uint(attempt-1)
+    if d > limit || d <= 0 {
+        d = limit
+    }
+    d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+
+    if remote != nil && (remote.StatusCode == http.StatusTooManyRequests || remote.StatusCode == http.StatusServiceUnavailable) {
+        if after := parseRetryAfter(remote.Header.Get("Retry-After")); after > 0 {
+            d = after
+        }
+    }
+    if d > limit {
+        d = limit
+    }
+    return d
+}
+
+type tokenBucket struct {
+    mu     sync.Mutex
+    rate   float64
+    burst  float64
+    tokens float64
+    last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+    return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+    for {
+        b.mu.Lock()
+        now := time.Now()
+        b.tokens += now.Sub(b.last).Seconds() * b.rate
+        if b.tokens > b.burst {
+            b.tokens = b.burst
+        }
+        b.last = now
+        if b.tokens >= 1 {
+            b.tokens--
+            b.mu.Unlock()
+            return nil
+        }
+        delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+        b.mu.Unlock()
+
+        timer := time.NewTimer(delay)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        case <-timer.C:
+        }
+    }
+}
+
+type fetchPipeline struct {
+    cfg     FetchConfig
+    mu      sync.Mutex
+    buckets map[string]*tokenBucket
+    slots   map[string]chan struct{}
+}
+
+func newFetchPipeline(cfg FetchConfig) *fetchPipeline {
+    return &fetchPipeline{cfg: cfg, buckets: map[string]*tokenBucket{}, slots: map[string]chan struct{}{}}
+}
+
+func (p *fetchPipeline) host(host string) (*tokenBucket, chan struct{}) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if _, ok := p.slots[host]; !ok {
+        if p.cfg.RatePerHost > 0 {
+            p.buckets[host] = newTokenBucket(p.cfg.RatePerHost, p.cfg.Burst)
+        }
+        p.slots[host] = make(chan struct{}, p.cfg.PerHost)
+    }
+    return p.buckets[host], p.slots[host]
+}
+
+// fetchJob is one name to fetch from one source.
+type fetchJob struct {
+    name  string
+    host  string
+    fetch func(context.Context, string) (*remoteFile, error)
+}
+
+// run fetches every name with at most cfg.Concurrency requests in flight and
+// returns the outcomes in the same order as names, however they complete.
+func (p *fetchPipeline) run(ctx context.Context, names []string, hostOf func(string) string, fetch func(context.Context, string) (*remoteFile, error)) []fetchOutcome {
+    jobs := make([]fetchJob, len(names))
+    for i, name := range names {
+        jobs[i] = fetchJob{name: name, host: hostOf(name), fetch: fetch}
+    }
+    return p.runJobs(ctx, jobs)
+}
+
+// runJobs is run for jobs that may come from several sources, so one worker
+// pool bounds the requests in flight across all of them.
+func (p *fetchPipeline) runJobs(ctx context.Context, jobs []fetchJob) []fetchOutcome {
+    outcomes := make([]fetchOutcome, len(jobs))
+    queue := make(chan int)
+
+    var wg sync.WaitGroup
+    for w := 0; w < p.cfg.Concurrency; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range queue {
+                outcomes[i] = p.fetchOne(ctx, jobs[i].name, jobs[i].host, jobs[i].fetch)
+            }
+        }()
+    }
+
+    for i := range jobs {
+        select {
+        case queue <- i:
+        case <-ctx.Done():
+            for j := i; j < len(jobs); j++ {
+                outcomes[j] = fetchOutcome{Err: ctx.Err()}
+            }
+            close(queue)
+            wg.Wait()
+            return outcomes
+        }
+    }
+    close(queue)
+    wg.Wait()
+    return outcomes
+}
+
+func (p *fetchPipeline) fetchOne(ctx context.Context, name, host string, fetch func(context.Context, string) (*remoteFile, error)) fetchOutcome {
+    bucket, slots := p.host(host)
+    select {
+    case slots <- struct{}{}:
+    case <-ctx.Done():
+        return fetchOutcome{Err: ctx.Err()}
+    }
+    defer func() { <-slots }()
+
+    outcome := fetchOutcome{}
+    for {
+        outcome.Attempts++
+        if bucket != nil {
+            if err := bucket.wait(ctx); err != nil {
+                outcome.Remote, outcome.Err = nil, err
+                return outcome
+            }
+        }
+        outcome.Remote, outcome.Err = fetch(ctx, name)
+
+        var tooLarge *tooLargeError
+        retry := outcome.Err != nil && !errors.As(outcome.Err, &tooLarge) && ctx.Err() == nil
+        if outcome.Err == nil && retryableStatus(outcome.Remote.StatusCode) {
+            retry = true
+        }
+        if !retry || outcome.Attempts > *p.cfg.Retries {
+            return outcome
+        }
+
+        timer := time.NewTimer(p.backoff(outcome.Attempts, outcome.Remote))
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return outcome
+        case <-timer.C:
+        }
+    }
+}
+
+func urlHost(rawURL string) string {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return rawURL
+    }
+    return u.Host
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// fixedTable is a catalogue-style text table: optional preamble lines (a
+// title), a header block between separator lines, then one record per line
+// with fields at fixed character positions. Rows[0] holds the column names.
+type fixedTable struct {
+    Preamble []string
+    Rows     [][]string
+}
+
+type columnSpan struct {
+    Name       string
+    Start, End int // 0-based, End exclusive; -1 runs to the end of the line
+}
+
+// isSeparatorLine matches rule lines such as "-----" or "==+===".
+func isSeparatorLine(line string) bool {
+    rule := 0
+    for _, c := range line {
+        switch c {
+        case '-', '=':
+            rule++
+        case '+', '|', ' ', '\t':
+        default:
+            return false
+        }
+    }
+    return rule >= 3
+}
+
+// parseFixedWidth splits data into preamble, header block and records.
+// With two separator lines the header block is what lies between them and
+// anything above the first is preamble; with one, everything above it is
+// the header block; with none, the first line is. Column spans come from
+// columns when given (1-based, inclusive), otherwise from the '|' dividers
+// in the first header line, and multi-line headers are joined per column.
+func parseFixedWidth(data []byte, columns []FixedColumn) (*fixedTable, error) {
+    lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+    var seps []int
+    for i, line := range lines {
+        if isSeparatorLine(line) {
+            seps = append(seps, i)
+            if len(seps) == 2 {
+                break
+            }
+        }
+    }
+
+    t := &fixedTable{}
+    var header []string
+    body := 1
+    switch {
+    case len(seps) == 2:
+        t.Preamble, header, body = lines[:seps[0]], lines[seps[0]+1:seps[1]], seps[1]+1
+    case len(seps) == 1:
+        header, body = lines[:seps[0]], seps[0]+1
+    case len(lines) > 0:
+        header = lines[:1]
+    }
+
+    spans, err := fixedSpans(header, columns)
+    if err != nil {
+        return nil, err
+    }
+    names := make([]string, len(spans))
+    for i, s := range spans {
+        names[i] = s.Name
+    }
+    t.Rows = append(t.Rows, names)
+
+    for _, line := range lines[body:] {
+        if strings.TrimSpace(line) == "" || isSeparatorLine(line) || inHeader(header, line) {
+            continue
+        }
+        row := make([]string, len(spans))
+        for i, s := range spans {
+            row[i] = sliceColumn(line, s.Start, s.End)
+        }
+        t.Rows = append(t.Rows, row)
+    }
+    return t, nil
+}
+
+// inHeader skips header lines repeated further down, as at page breaks.
+func inHeader(header []string, line string) bool {
+    for _, h := range header {
+        if strings.TrimSpace(h) != "" && line == h {
+            return true
+        }
+    }
+    return false
+}
+
+func fixedSpans(header []string, columns []FixedColumn) ([]columnSpan, error) {
+    if len(columns) > 0 {
+        spans := make([]columnSpan, len(columns))
+        for i, c := range columns {
+            spans[i] = columnSpan{Name: c.Name, Start: c.Start - 1, End: c.End}
+            if c.End == 0 {
+                spans[i].End = -1
+            }
+        }
+        return spans, nil
+    }
+
+    if len(header) == 0 || !strings.Contains(header[0], "|") {
+        return nil, fmt.Errorf("no '|' dividers in the header block; configure columns")
+    }
+    var spans []columnSpan
+    start := 0
+    for i, c := range header[0] {
+        if c == '|' {
+            spans = append(spans, columnSpan{Start: start, End: i})
+            start = i
+        }
+    }
+    spans = append(spans, columnSpan{Start: start, End: -1})
+
+    for i := range spans {
+        var parts []string
+        for _, line := range header {
+            if part := strings.Trim(sliceColumn(line, spans[i].Start, spans[i].End), "| "); part != "" {
+                parts = append(parts, part)
+            }
+        }
+        spans[i].Name = strings.Join(parts, " ")
+        if spans[i].Name == "" {
+            spans[i].Name = fmt.Sprintf("col %d", i+1)
+        }
+    }
+    return spans, nil
+}
+
+func sliceColumn(line string, start, end int) string {
+    if start >= len(line) {
+        return ""
+    }
+    if end < 0 || end > len(line) {
+        end = len(line)
+    }
+    return strings.TrimSpace(line[start:end])
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestParseFixedWidth(t *testing.T) {
+    catalogue := strings.Join([]string{
+        "Catalogue of bright stars",
+        "",
+        "------------------------------",
+        "Name     | Mag  | Dist  | Type",
+        "         |      | (ly)  |",
+        "------------------------------",
+        "Sirius     -1.46   8.6   A1V   ",
+        "Canopus    -0.74         F0II",
+        "Vega        0.03  25.0   A0V",
+        "Name     | Mag  | Dist  | Type",
+        "Rigel       0.13",
+        "Deneb",
+        "",
+    }, "\n")
+
+    tests := []struct {
+        name     string
+        data     string
+        columns  []FixedColumn
+        preamble []string
+        rows     [][]string
+    }{
+        {"inferred layout", catalogue, nil,
+            []string{"Catalogue of bright stars", ""},
+            [][]string{
+                {"Name", "Mag", "Dist (ly)", "Type"},
+                // Trailing whitespace after the last field is dropped.
+                {"Sirius", "-1.46", "8.6", "A1V"},
+                // A blank gap under a column is an empty field.
+                {"Canopus", "-0.74", "", "F0II"},
+                {"Vega", "0.03", "25.0", "A0V"},
+                // Lines shorter than the layout leave the rest empty; the
+                // repeated header line above them is skipped.
+                {"Rigel", "0.13", "", ""},
+                {"Deneb", "", "", ""},
+            }},
+        {"configured columns", catalogue, []FixedColumn{{Name: "Star", Start: 1, End: 9}, {Name: "Type", Start: 25}},
+            []string{"Catalogue of bright stars", ""},
+            [][]string{
+                {"Star", "Type"},
+                {"Sirius", "A1V"},
+                {"Canopus", "F0II"},
+                {"Vega", "A0V"},
+                {"Rigel", ""},
+                {"Deneb", ""},
+            }},
+        {"one separator", "ID | Value\n----------\n1    ten  \n22\n", nil, nil,
+            [][]string{{"ID", "Value"}, {"1", "ten"}, {"22", ""}}},
+        {"no separator", "ID | Value\r\n1    ten\r\n", nil, nil,
+            [][]string{{"ID", "Value"}, {"1", "ten"}}},
+        {"unnamed column", "ID |      | Value\n--------------------\n1    x    ten\n", nil, nil,
+            [][]string{{"ID", "col 2", "Value"}, {"1", "x", "ten"}}},
+    }
+    for _, tt := range tests {
+        got, err := parseFixedWidth([]byte(tt.data), tt.columns)
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        if !reflect.DeepEqual(got.Preamble, tt.preamble) {
+            t.Errorf("%s: preamble %q, want %q", tt.name, got.Preamble, tt.preamble)
+        }
+        if !reflect.DeepEqual(got.Rows, tt.rows) {
+            t.Errorf("%s: rows %q, want %q", tt.name, got.Rows, tt.rows)
+        }
+    }
+}
+
+func TestParseFixedWidthNoDividers(t *testing.T) {
+    if _, err := parseFixedWidth([]byte("ID  Value\n--------\n1   ten\n"), nil); err == nil {
+        t.Error("inferred columns without '|' dividers")
+    }
+}
+
+func TestIsSeparatorLine(t *testing.T) {
+    tests := map[string]bool{
+        "-----":      true,
+        "==+===":     true,
+        "--- | ---":  true,
+        "--":         false,
+        "":           false,
+        "1-2-3-4":    false,
+        "   \t   ":   false,
+        "-----x----": false,
+    }
+    for line, want := range tests {
+        if got := isSeparatorLine(line); got != want {
+            t.Errorf("isSeparatorLine(%q) = %v, want %v", line, got, want)
+        }
+    }
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const gitStateFile = "git.json"
+
+// gitSource reads files from a git repository at a ref. With an origin URL
+// the repository is a bare mirror under the state dir that is refreshed
+// before each cycle. pin resolves the ref once so that every file in a cycle
+// comes from the same commit.
+type gitSource struct {
+    repo     string
+    ref      string
+    origin   string
+    localDir string
+    maxSize  int64
+
+    mu      sync.Mutex
+    commit  string
+    tree    map[string]string
+    history *gitState
+}
+
+// gitState is what earlier cycles saw of the ref. Observed keeps the pinned
+// tip and any earlier tip that is not one of its ancestors; ancestors are
+// dropped since they can only vanish along with the tip, which is reported.
+type gitState struct {
+    Ref      string           `json:"ref"`
+    Commit   string           `json:"commit"`
+    Observed []observedCommit `json:"observed"`
+}
+
+type observedCommit struct {
+    Commit    string     `json:"commit"`
+    FirstSeen time.Time  `json:"first_seen"`
+    Vanished  *time.Time `json:"vanished,omitempty"`
+}
+
+func (s *gitSource) String() string {
+    if s.origin != "" {
+        return s.origin + "@" + s.ref
+    }
+    return s.repo + "@" + s.ref
+}
+
+func (s *gitSource) Host() string {
+    return "git:" + s.repo
+}
+
+func (s *gitSource) Location(filename string) string {
+    base, rev := s.repo, s.ref
+    if s.origin != "" {
+        base = s.origin
+    }
+    if s.commit != "" {
+        rev = s.commit
+    }
+    return base + "@" + rev + ":" + filename
+}
+
+func gitOutput(ctx context.Context, repo string, args ...string) ([]byte, error) {
+    cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, args...)...)
+    var stderr bytes.Buffer
+    cmd.Stderr = &stderr
+    out, err := cmd.Output()
+    if err != nil {
+        if msg := strings.TrimSpace(stderr.String()); msg != "" {
+            return nil, fmt.Errorf("git %s: %s", args[0], msg)
+        }
+        return nil, fmt.Errorf("git %s: %v", args[0], err)
+    }
+    return out, nil
+}
+
+func gitBlobHash(data []byte) string {
+    h := sha1.New()
+    h.Write([]byte("blob " + strconv.Itoa(len(data)) + "\x00"))
+    h.Write(data)
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *gitSource) sync(ctx context.Context) error {
+    if s.origin == "" {
+        return nil
+    }
+    if _, err := os.Stat(s.repo); os.IsNotExist(err) {
+        cmd := exec.CommandContext(ctx, "git", "clone", "--mirror", "--quiet", s.origin, s.repo)
+        if out, err := cmd.CombinedOutput(); err != nil {
+            return fmt.Errorf("git clone --mirror %s: %s", s.origin, strings.TrimSpace(string(out)))
+        }
+        return nil
+    }
+    _, err := gitOutput(ctx, s.repo, "fetch", "--prune", "--quiet", "origin")
+    return err
+}
+
+func (s *gitSource) resolve(ctx context.Context) (string, error) {
+    out, err := gitOutput(ctx, s.repo, "rev-parse", "--verify", "--quiet", s.ref+"^{commit}")
+    if err != nil {
+        return "", fmt.Errorf("cannot resolve %s in %s: %v", s.ref, s.repo, err)
+    }
+    return strings.TrimSpace(string(out)), nil
+}
+
+func (s *gitSource) pin(ctx context.Context) error {
+    if err := s.sync(ctx); err != nil {
+        return err
+    }
+    commit, err := s.resolve(ctx)
+    if err != nil {
+        return err
+    }
+
+    out, err := gitOutput(ctx, s.repo, "ls-tree", "-r", "-z", commit)
+    if err != nil {
+        return err
+    }
+    tree := map[string]string{}
+    for _, line := range strings.Split(string(out), "\x00") {
+        // <mode> SP <type> SP <object> TAB <path>
+        meta, path, ok := strings.Cut(line, "\t")
+        fields := strings.Fields(meta)
+        if !ok || len(fields) != 3 || fields[1] != "blob" {
+            continue
+        }
+        tree[path] = fields[2]
+    }
+    s.mu.Lock()
+    s.commit, s.tree = commit, tree
+    s.mu.Unlock()
+    return nil
+}
+
+func (s *gitSource) Fetch(ctx context.Context, filename string) (*remoteFile, error) {
+    s.mu.Lock()
+    commit, tree := s.commit, s.tree
+    s.mu.Unlock()
+    if commit == "" {
+        return nil, fmt.Errorf("%s is not pinned to a commit", s)
+    }
+
+    remote := &remoteFile{URL: s.Location(filename), StatusCode: http.StatusOK, Commit: commit}
+    blob, ok := tree[filename]
+    if !ok {
+        remote.StatusCode = http.StatusNotFound
+        return remote, nil
+    }
+    remote.Header = http.Header{"X-Git-Commit": {commit}, "X-Git-Blob": {blob}}
+
+    // A local copy with the same blob id is the remote content; skip reading
+    // it out of the repository.
+    if local, err := os.ReadFile(filepath.Join(s.localDir, filename)); err == nil && gitBlobHash(local) == blob {
+        remote.Body = local
+        return remote, nil
+    }
+
+    body, err := gitOutput(ctx, s.repo, "cat-file", "blob", blob)
+    if err != nil {
+        return nil, err
+    }
+    if int64(len(body)) > s.maxSize {
+        return nil, &tooLargeError{Size: int64(len(body)), Limit: s.maxSize}
+    }
+    remote.Body = body
+    return remote, nil
+}
+
+func (s *gitSource) List(ctx context.Context) ([]string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.commit == "" {
+        return nil, fmt.Errorf("%s is not pinned to a commit", s)
+    }
+    names := make([]string, 0, len(s.tree))
+    for name := range s.tree {
+        names = append(names, name)
+    }
+    return names, nil
+}
+
+func (s *gitSource) isAncestor(ctx context.Context, older, newer string) bool {
+    cmd := exec.CommandContext(ctx, "git", "-C", s.repo, "merge-base", "--is-ancestor", older, newer)
+    return cmd.Run() == nil
+}
+
+func (s *gitSource) reachable(ctx context.Context, commit string) bool {
+    if _, err := gitOutput(ctx, s.repo, "cat-file", "-e", commit+"^{commit}"); err != nil {
+        return false
+    }
+    out, err := gitOutput(ctx, s.repo, "for-each-ref", "--count=1", "--contains", commit, "--format=%(refname)")
+    return err == nil && len(bytes.TrimSpace(out)) > 0
+}
+
+func gitStatePath(ws *WatchSet) string {
+    return filepath.Join(ws.StateDir, gitStateFile)
+}
+
+func loadGitState(ws *WatchSet) (*gitState, error) {
+    data, err := os.ReadFile(gitStatePath(ws))
+    if err != nil {
+        if errors.Is(err, os.ErrNotExist) {
+            return &gitState{}, nil
+        }
+        return nil, err
+    }
+    var state gitState
+    if err := json.Unmarshal(data, &state); err != nil {
+        return nil, fmt.Errorf("%s: %v", gitStatePath(ws), err)
+    }
+    return &state, nil
+}
+
+func saveGitState(ws *WatchSet, state *gitState) error {
+    data, err := json.MarshalIndent(state, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(gitStatePath(ws), append(data, '\n'))
+}
+
+// checkGitHistory compares the pinned commit with what earlier cycles saw and
+// returns an entry for a non-fast-forward move of the ref and for every
+// previously observed commit that is no longer reachable from any ref. The
+// updated state is kept on the source and only saved once the cycle completes.
+func checkGitHistory(ctx context.Context, ws *WatchSet, s *gitSource, ts string) ([]shiftEntry, error) {
+    state, err := loadGitState(ws)
+    if err != nil {
+        return nil, err
+    }
+
+    var alerts []shiftEntry
+    if state.Commit != "" && state.Commit != s.commit && state.Ref == s.ref && !s.isAncestor(ctx, state.Commit, s.commit) {
+        alerts = append(alerts, shiftEntry{File: s.ref, Kind: "rewrite", Text: fmt.Sprintf("[%s] %s: History rewritten - %s moved non-fast-forward from %s to %s\n", ts, s.String(), s.ref, state.Commit, s.commit)})
+    }
+
+    now := time.Now().UTC()
+    seen := false
+    kept := state.Observed[:0]
+    for _, observed := range state.Observed {
+        switch {
+        case observed.Commit == s.commit:
+            seen = true
+            observed.Vanished = nil
+        case observed.Vanished != nil:
+        case s.isAncestor(ctx, observed.Commit, s.commit):
+            continue
+        case !s.reachable(ctx, observed.Commit):
+            observed.Vanished = &now
+            alerts = append(alerts, shiftEntry{File: s.ref, Kind: "vanished", Text: fmt.Sprintf("[%s] %s: Previously observed commit %s (first seen %s) is no longer reachable from any ref\n", ts, s.String(), observed.Commit, observed.FirstSeen.Local().Format(time.RFC3339))})
+        }
+        kept = append(kept, observed)
+    }
+    state.Observed = kept
+    if !seen {
+        state.Observed = append(state.Observed, observedCommit{Commit: s.commit, FirstSeen: now})
+    }
+    state.Ref, state.Commit = s.ref, s.commit
+    s.history = state
+    return alerts, nil
+}
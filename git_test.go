@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+    t.Helper()
+    cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.org", "-c", "init.defaultBranch=main"}, args...)...)
+    out, err := cmd.CombinedOutput()
+    if err != nil {
+        t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+    }
+    return strings.TrimSpace(string(out))
+}
+
+// commitFile commits one change in work and pushes it, forcing when asked.
+func commitFile(t *testing.T, work, content string, force bool) string {
+    t.Helper()
+    if err := os.WriteFile(filepath.Join(work, "data.csv"), []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+    runGit(t, work, "add", "data.csv")
+    runGit(t, work, "commit", "-q", "-m", content)
+    push := []string{"push", "-q", "origin", "HEAD:refs/heads/main"}
+    if force {
+        push = append(push, "--force")
+    }
+    runGit(t, work, push...)
+    return runGit(t, work, "rev-parse", "HEAD")
+}
+
+func TestCheckGitHistory(t *testing.T) {
+    if _, err := exec.LookPath("git"); err != nil {
+        t.Skip("git not installed")
+    }
+    root := t.TempDir()
+    origin, work := filepath.Join(root, "origin.git"), filepath.Join(root, "work")
+    runGit(t, root, "init", "-q", "--bare", origin)
+    runGit(t, root, "init", "-q", work)
+    runGit(t, work, "remote", "add", "origin", origin)
+
+    ws := &WatchSet{Name: "git", Dir: filepath.Join(root, "local"), StateDir: filepath.Join(root, "state")}
+    // cycle pins the ref with a fresh source, as every cycle does, and
+    // returns the alert kinds and the commits kept in the saved state.
+    cycle := func() ([]string, []observedCommit) {
+        t.Helper()
+        gs := &gitSource{repo: filepath.Join(ws.StateDir, "mirror.git"), ref: "refs/heads/main", origin: origin, localDir: ws.Dir}
+        if err := gs.pin(context.Background()); err != nil {
+            t.Fatal(err)
+        }
+        alerts, err := checkGitHistory(context.Background(), ws, gs, "ts")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := saveGitState(ws, gs.history); err != nil {
+            t.Fatal(err)
+        }
+        var kinds []string
+        for _, a := range alerts {
+            kinds = append(kinds, a.Kind)
+        }
+        return kinds, gs.history.Observed
+    }
+    commits := func(observed []observedCommit) []string {
+        var out []string
+        for _, o := range observed {
+            c := o.Commit
+            if o.Vanished != nil {
+                c += " vanished"
+            }
+            out = append(out, c)
+        }
+        return out
+    }
+    check := func(step string, kinds []string, observed []observedCommit, wantKinds, wantCommits []string) {
+        t.Helper()
+        if strings.Join(kinds, ",") != strings.Join(wantKinds, ",") {
+            t.Errorf("%s: alerts %v, want %v", step, kinds, wantKinds)
+        }
+        if got := commits(observed); strings.Join(got, ",") != strings.Join(wantCommits, ",") {
+            t.Errorf("%s: observed %v, want %v", step, got, wantCommits)
+        }
+    }
+
+    commitFile(t, work, "a\n", false)
+    c2 := commitFile(t, work, "a\nb\n", false)
+    kinds, observed := cycle()
+    check("first cycle", kinds, observed, nil, []string{c2})
+
+    c3 := commitFile(t, work, "a\nb\nc\n", false)
+    kinds, observed = cycle()
+    check("fast-forward", kinds, observed, nil, []string{c3})
+
+    runGit(t, work, "reset", "-q", "--hard", "HEAD~1")
+    c3b := commitFile(t, work, "a\nb\nC\n", true)
+    kinds, observed = cycle()
+    check("force-push", kinds, observed, []string{"rewrite", "vanished"}, []string{c3 + " vanished", c3b})
+
+    kinds, observed = cycle()
+    check("after force-push", kinds, observed, nil, []string{c3 + " vanished", c3b})
+
+    c4 := commitFile(t, work, "a\nb\nC\nd\n", false)
+    kinds, observed = cycle()
+    check("fast-forward after force-push", kinds, observed, nil, []string{c3 + " vanished", c4})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type observedVersion struct {
+    Object    string
+    Commit    string
+    FirstSeen time.Time
+    LastSeen  time.Time
+    Cycles    int
+}
+
+func fileObservations(ws *WatchSet, filename string) ([]IndexEntry, error) {
+    entries, err := readIndex(ws)
+    if err != nil {
+        return nil, err
+    }
+    var observed []IndexEntry
+    for _, entry := range entries {
+        if entry.File == filename {
+            observed = append(observed, entry)
+        }
+    }
+    return observed, nil
+}
+
+func fileVersions(observations []IndexEntry) []*observedVersion {
+    var versions []*observedVersion
+    for _, entry := range observations {
+        if entry.Object == "" {
+            continue
+        }
+        if n := len(versions); n > 0 && versions[n-1].Object == entry.Object {
+            versions[n-1].LastSeen = entry.Time
+            versions[n-1].Cycles++
+            if entry.Commit != "" {
+                versions[n-1].Commit = entry.Commit
+            }
+            continue
+        }
+        versions = append(versions, &observedVersion{Object: entry.Object, Commit: entry.Commit, FirstSeen: entry.Time, LastSeen: entry.Time, Cycles: 1})
+    }
+    return versions
+}
+
+func objectAt(observations []IndexEntry, at time.Time) (*IndexEntry, error) {
+    var found *IndexEntry
+    for i := range observations {
+        entry := &observations[i]
+        if entry.Object == "" || entry.Time.After(at) {
+            continue
+        }
+        if found == nil || !entry.Time.Before(found.Time) {
+            found = entry
+        }
+    }
+    if found == nil {
+        return nil, fmt.Errorf("no version observed at or before %s", at.Format(time.RFC3339))
+    }
+    return found, nil
+}
+
+func resolveVersion(ws *WatchSet, observations []IndexEntry, when string) (*IndexEntry, error) {
+    if isHexPrefix(when) {
+        var match *IndexEntry
+        for i := range observations {
+            if strings.HasPrefix(observations[i].Object, strings.ToLower(when)) {
+                if match != nil && match.Object != observations[i].Object {
+                    return nil, fmt.Errorf("object prefix %s is ambiguous", when)
+                }
+                match = &observations[i]
+            }
+        }
+        if match != nil {
+            return match, nil
+        }
+    }
+
+    at, err := parseWhen(when)
+    if err != nil {
+        return nil, err
+    }
+    return objectAt(observations, at)
+}
+
+func isHexPrefix(s string) bool {
+    if len(s) < 8 || len(s) > 64 {
+        return false
+    }
+    for _, c := range strings.ToLower(s) {
+        if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+            return false
+        }
+    }
+    return true
+}
+
+func parseWhen(s string) (time.Time, error) {
+    s = strings.TrimSpace(s)
+    now := time.Now()
+    if s == "" || s == "now" {
+        return now, nil
+    }
+    if ago := strings.TrimSpace(strings.TrimSuffix(s, "ago")); ago != s {
+        if d, err := parseAgo(strings.TrimSuffix(ago, "-")); err == nil {
+            return now.Add(-d), nil
+        }
+    }
+
+    if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+        return t, nil
+    }
+    for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+        if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+            return t, nil
+        }
+    }
+    if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+        return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+    }
+    return time.Time{}, fmt.Errorf("cannot parse time %q (use RFC 3339, YYYY-MM-DD[ HH:MM[:SS]], now, 2h ago, 3d ago or an object hash prefix)", s)
+}
+
+func parseAgo(s string) (time.Duration, error) {
+    s = strings.TrimSpace(s)
+    if strings.HasSuffix(s, "d") {
+        days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+        if err != nil {
+            return 0, err
+        }
+        return time.Duration(days) * 24 * time.Hour, nil
+    }
+    return time.ParseDuration(s)
+}
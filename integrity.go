@@ -2,6 +2,7 @@ package main
 
 import (
     "bufio"
+    "context"
     "crypto/sha256"
     "encoding/csv"
     "encoding/hex"
@@ -9,12 +10,13 @@ import (
     "io"
     "math/rand"
     "net/http"
-    "net/url"
     "os"
+    "os/signal"
     "path/filepath"
     "sort"
     "strconv"
     "strings"
+    "syscall"
     "time"
 
     exifpkg "github.com/rwcarlsen/goexif/exif"
@@ -23,13 +25,19 @@ import (
 )
 
 const (
-    baseURL        = "https://raw.githubusercontent.com/dream-three/baseline/refs/heads/main/"
-    defaultMinutes = 60
-    fetchPause     = 5 * time.Second
-    logFile        = "shifts.log"
-    maxDiffChanges = 10
-    maxDiffChars   = 500
-    zeroHash       = "0000000000000000000000000000000000000000000000000000000000000000"
+    baseURL              = "https://raw.githubusercontent.com/dream-three/baseline/refs/heads/main/"
+    defaultConcurrency   = 4
+    defaultFlapThreshold = 4
+    defaultFullInterval  = 24 * time.Hour
+    defaultMaxSize       = 256 << 20
+    defaultProfile       = "googlebot"
+    defaultMinutes       = 60
+    defaultRatePerHost   = 2.0
+    defaultRetries       = 2
+    logFile              = "shifts.jsonl"
+    maxDiffChanges       = 10
+    maxDiffChars         = 500
+    zeroHash             = "0000000000000000000000000000000000000000000000000000000000000000"
 )
 
 var imageExts = []string{".jpg", ".jpeg", ".png", ".avif"}
@@ -37,24 +45,10 @@ var imageExts = []string{".jpg", ".jpeg", ".png", ".avif"}
 func main() {
     rand.Seed(time.Now().UnixNano())
 
-    baselineMode := promptBaselineMode()
-
-    runningDir, err := os.Getwd()
-    if err != nil {
-        fmt.Printf("Error getting running directory: %v\n", err)
-        return
-    }
-
-    if baselineMode {
-        fetchBaselines(runningDir)
-    }
-
-    interval := promptInterval()
-
-    for {
-        runCycle(interval, runningDir)
-        time.Sleep(time.Duration(interval) * time.Minute)
-    }
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    code := run(ctx, os.Args[1:])
+    stop()
+    os.Exit(code)
 }
 
 func promptBaselineMode() bool {
@@ -79,324 +73,560 @@ func promptInterval() int {
     return defaultMinutes
 }
 
-func randomTimestamp() string {
-    return strconv.FormatInt(time.Now().UnixNano(), 16) + "-" + strconv.Itoa(rand.Intn(1000000))
+func trackedFiles(ws *WatchSet, manifest *Manifest) ([]string, error) {
+    filenames, err := scanDir(ws)
+    if err != nil {
+        return nil, err
+    }
+
+    seen := map[string]bool{}
+    for _, filename := range filenames {
+        seen[filename] = true
+    }
+    for _, filename := range manifest.names() {
+        if !seen[filename] && ws.matches(filename) {
+            filenames = append(filenames, filename)
+        }
+    }
+    sort.Strings(filenames)
+    return filenames, nil
+}
+
+func fetchAll(ctx context.Context, ws *WatchSet, source Source, filenames []string) []fetchOutcome {
+    hostOf := func(string) string { return source.Host() }
+    return newFetchPipeline(ws.Fetch).run(ctx, filenames, hostOf, source.Fetch)
+}
+
+// prepareSource pins a git source to a single commit for the whole cycle and
+// checks the ref's history against what earlier cycles observed. For an http
+// source with cheap checks it loads what earlier downloads returned.
+func prepareSource(ctx context.Context, ws *WatchSet, source Source, ts string) ([]shiftEntry, error) {
+    if hs, ok := source.(*httpSource); ok && ws.Fetch.CheapCheck != "off" {
+        cheap, err := loadCheapCheck(ws)
+        hs.cheap = cheap
+        return nil, err
+    }
+    gs, ok := source.(*gitSource)
+    if !ok {
+        return nil, nil
+    }
+    if err := gs.pin(ctx); err != nil {
+        return nil, err
+    }
+    fmt.Printf("[%s] %s resolved to commit %s\n", ts, gs.ref, gs.commit)
+
+    alerts, err := checkGitHistory(ctx, ws, gs, ts)
+    for _, alert := range alerts {
+        fmt.Print(alert.Text)
+    }
+    return alerts, err
 }
 
-func fetchBaselines(runningDir string) {
+func saveSourceState(ws *WatchSet, source Source) error {
+    if hs, ok := source.(*httpSource); ok && hs.cheap != nil {
+        return hs.cheap.save(ws)
+    }
+    if gs, ok := source.(*gitSource); ok && gs.history != nil {
+        return saveGitState(ws, gs.history)
+    }
+    return nil
+}
+
+func fetchBaselines(ctx context.Context, ws *WatchSet) {
     ts := time.Now().Format("Jan 02, 2006 - 03:04PM")
-    fmt.Println("Baseline mode: Fetching remote CSVs, PDFs, and images as initial baselines...")
+    fmt.Printf("Baseline mode (%s): Fetching remote CSVs, PDFs, and images as initial baselines...\n", ws.Name)
 
-    dir, err := os.Open(runningDir)
+    manifest, err := loadManifest(ws)
     if err != nil {
-        fmt.Printf("[%s] Error opening directory: %v\n", ts, err)
+        fmt.Printf("[%s] Error loading manifest: %v\n", ts, err)
         return
     }
-    defer dir.Close()
 
-    names, err := dir.Readdirnames(-1)
+    baselineFiles, err := trackedFiles(ws, manifest)
     if err != nil {
         fmt.Printf("[%s] Error reading directory: %v\n", ts, err)
         return
     }
 
-    var baselineFiles []string
-    for _, filename := range names {
-        ext := strings.ToLower(filepath.Ext(filename))
-        if ext == ".csv" || ext == ".pdf" {
-            baselineFiles = append(baselineFiles, filename)
-        } else {
-            for _, imgExt := range imageExts {
-                if ext == imgExt && strings.Contains(strings.ToLower(filename), "map") {
-                    baselineFiles = append(baselineFiles, filename)
-                    break
-                }
-            }
-        }
+    source := ws.source()
+    historyLog, err := prepareSource(ctx, ws, source, ts)
+    if err != nil {
+        fmt.Printf("[%s] Error preparing source %s: %v\n", ts, source, err)
+        return
     }
 
-    for i, originalFilename := range baselineFiles {
-        localPath := filepath.Join(runningDir, originalFilename)
-        encodedFilename := url.PathEscape(originalFilename)
-        rawURL := baseURL + encodedFilename + "?t=" + randomTimestamp()
+    outcomes := fetchAll(ctx, ws, source, baselineFiles)
+    if ctx.Err() != nil {
+        fmt.Printf("[%s] Baseline cancelled, manifest left unchanged\n", ts)
+        return
+    }
 
-        if i > 0 {
-            time.Sleep(fetchPause)
-        }
+    store := openStore(ws)
+    schemas, err := loadSchemas(ws)
+    if err != nil {
+        fmt.Printf("[%s] Error loading schemas: %v\n", ts, err)
+        return
+    }
+    baselineAt := time.Now().UTC()
+    var indexEntries []IndexEntry
 
-        client := &http.Client{
-            Timeout: 30 * time.Second,
-        }
-        req, err := http.NewRequest("GET", rawURL, nil)
-        if err != nil {
-            fmt.Printf("[%s] %s: Baseline request failed: %v\n", ts, originalFilename, err)
-            continue
-        }
-        req.Header.Set("User-Agent", "Googlebot/2.1; +http://www.google.com/bot.html")
-        req.Header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
-        req.Header.Set("Pragma", "no-cache")
-        req.Header.Set("Expires", "0")
-        req.Header.Set("If-Modified-Since", "Thu, 01 Jan 1970 00:00:00 GMT")
-        req.Header.Set("If-None-Match", "")
-        req.Header.Set("Connection", "close")
-        req.Header.Del("Accept-Encoding")
-
-        resp, err := client.Do(req)
+    for i, originalFilename := range baselineFiles {
+        localPath := filepath.Join(ws.Dir, originalFilename)
+
+        remote, err := outcomes[i].Remote, outcomes[i].Err
         if err != nil {
-            fmt.Printf("[%s] %s: Baseline fetch failed: %v\n", ts, originalFilename, err)
+            fmt.Printf("[%s] %s: Baseline fetch failed (%s%s): %v\n", ts, originalFilename, fetchStatus(err), outcomes[i].attemptsDetail(), err)
             continue
         }
-        defer resp.Body.Close()
-
-        if resp.StatusCode != http.StatusOK {
-            fmt.Printf("[%s] %s: Baseline HTTP %d (URL: %s)\n", ts, originalFilename, resp.StatusCode, rawURL)
+        if remote.StatusCode != http.StatusOK {
+            fmt.Printf("[%s] %s: Baseline HTTP %d (URL: %s)\n", ts, originalFilename, remote.StatusCode, remote.URL)
             continue
         }
 
-        body, err := io.ReadAll(resp.Body)
+        err = os.WriteFile(localPath, remote.Body, 0644)
         if err != nil {
-            fmt.Printf("[%s] %s: Baseline read failed: %v\n", ts, originalFilename, err)
+            fmt.Printf("[%s] %s: Baseline save failed: %v\n", ts, originalFilename, err)
             continue
         }
 
-        err = os.WriteFile(localPath, body, 0644)
-        if err != nil {
-            fmt.Printf("[%s] %s: Baseline save failed: %v\n", ts, originalFilename, err)
-            continue
+        manifest.record(originalFilename, remote)
+        if _, err := store.put(remote.Body); err != nil {
+            fmt.Printf("[%s] %s: Store object failed: %v\n", ts, originalFilename, err)
+        }
+        if ws.fileType(originalFilename) == "csv" {
+            if _, err := schemas.record(ws, originalFilename, manifest.Files[originalFilename].SHA256, remote.Body); err != nil {
+                fmt.Printf("[%s] %s: Schema not inferred: %v\n", ts, originalFilename, err)
+            }
         }
+        indexEntries = append(indexEntries, IndexEntry{
+            Cycle:  "baseline-" + baselineAt.Format(time.RFC3339Nano),
+            Time:   baselineAt,
+            File:   originalFilename,
+            Object: manifest.Files[originalFilename].SHA256,
+            Commit: remote.Commit,
+            Status: "baseline",
+        })
+        fmt.Printf("[%s] %s: Baseline saved (sha256: %s)\n", ts, originalFilename, manifest.Files[originalFilename].SHA256[:8])
+    }
 
-        fmt.Printf("[%s] %s: Baseline saved\n", ts, originalFilename)
+    if err := appendIndex(ws, indexEntries); err != nil {
+        fmt.Printf("[%s] Error writing index: %v\n", ts, err)
+    }
+    if len(historyLog) > 0 {
+        writeOutputs(ws, ts, historyLog)
+    }
+    if err := saveSourceState(ws, source); err != nil {
+        fmt.Printf("[%s] Error saving source state: %v\n", ts, err)
+    }
+    if err := schemas.save(ws); err != nil {
+        fmt.Printf("[%s] Error saving schemas: %v\n", ts, err)
     }
+    if err := saveManifest(ws, manifest); err != nil {
+        fmt.Printf("[%s] Error saving manifest: %v\n", ts, err)
+        return
+    }
+    fmt.Printf("[%s] Manifest written to %s (%d files)\n", ts, manifestPath(ws), len(manifest.Files))
 }
 
-func runCycle(interval int, runningDir string) {
+// runCycle checks every tracked file once and returns the number of remote
+// shifts logged: tracked files that changed, were renamed, deleted or went
+// missing, and new files listed upstream. A changed or added file is only
+// logged the first cycle its new content is confirmed.
+// The error is set when the cycle could not run to completion.
+func runCycle(ctx context.Context, ws *WatchSet) (int, error) {
+    startedAt := time.Now().UTC()
     ts := time.Now().Format("Jan 02, 2006 - 03:04PM")
-    fmt.Printf("[%s] Starting cycle, scanning %s for .csv, .pdf, and image files\n", ts, runningDir)
+    fmt.Printf("[%s] Starting cycle for %s, scanning %s for .csv, .pdf, and image files\n", ts, ws.Name, ws.Dir)
 
-    var csvFiles, pdfFiles, imageFiles []string
-    dir, err := os.Open(runningDir)
+    manifest, err := loadManifest(ws)
     if err != nil {
-        fmt.Printf("[%s] Error opening directory: %v\n", ts, err)
-        return
+        fmt.Printf("[%s] Error loading manifest: %v\n", ts, err)
+        return 0, fmt.Errorf("loading manifest: %w", err)
+    }
+    if len(manifest.Files) == 0 {
+        fmt.Printf("[%s] No baseline manifest at %s; trusting local files until `baseline` is run\n", ts, manifestPath(ws))
     }
-    defer dir.Close()
 
-    names, err := dir.Readdirnames(-1)
+    filenames, err := trackedFiles(ws, manifest)
     if err != nil {
         fmt.Printf("[%s] Error reading directory: %v\n", ts, err)
-        return
-    }
-
-    for _, filename := range names {
-        ext := strings.ToLower(filepath.Ext(filename))
-        if ext == ".csv" {
-            csvFiles = append(csvFiles, filepath.Join(runningDir, filename))
-        } else if ext == ".pdf" {
-            pdfFiles = append(pdfFiles, filepath.Join(runningDir, filename))
-        } else {
-            for _, imgExt := range imageExts {
-                if ext == imgExt && strings.Contains(strings.ToLower(filename), "map") {
-                    imageFiles = append(imageFiles, filepath.Join(runningDir, filename))
-                    break
-                }
-            }
+        return 0, fmt.Errorf("reading %s: %w", ws.Dir, err)
+    }
+
+    csvCount, pdfCount, imageCount := 0, 0, 0
+    for _, filename := range filenames {
+        switch ws.fileType(filename) {
+        case "csv":
+            csvCount++
+        case "pdf":
+            pdfCount++
+        case "image":
+            imageCount++
         }
     }
 
-    fmt.Printf("[%s] Found %d .csv files, %d .pdf files, and %d image files\n", ts, len(csvFiles), len(pdfFiles), len(imageFiles))
+    fmt.Printf("[%s] Found %d .csv files, %d .pdf files, and %d image files\n", ts, csvCount, pdfCount, imageCount)
 
-    var filenames []string
-    for _, localPath := range csvFiles {
-        filename := filepath.Base(localPath)
-        filenames = append(filenames, filename)
+    source := ws.source()
+    historyLog, err := prepareSource(ctx, ws, source, ts)
+    if err != nil {
+        fmt.Printf("[%s] Error preparing source %s: %v\n", ts, source, err)
+        return 0, fmt.Errorf("preparing source %s: %w", source, err)
     }
-    for _, localPath := range pdfFiles {
-        filename := filepath.Base(localPath)
-        filenames = append(filenames, filename)
+
+    listed, err := listSource(ctx, ws, source)
+    if err != nil {
+        fmt.Printf("[%s] Error listing %s, skipping remote discovery: %v\n", ts, source, err)
     }
-    for _, localPath := range imageFiles {
-        filename := filepath.Base(localPath)
-        filenames = append(filenames, filename)
+    added := untrackedNames(filenames, listed)
+    if len(added) > 0 {
+        fmt.Printf("[%s] Remote lists %d files that are not tracked locally\n", ts, len(added))
     }
 
-    sort.Strings(filenames)
-
-    var unifiedBuilder strings.Builder
-    var shiftLog []string
+    fetched := append(append([]string{}, filenames...), added...)
+    outcomes := fetchAll(ctx, ws, source, fetched)
+    store := openStore(ws)
+    stability, err := loadStability(ws)
+    if err != nil {
+        fmt.Printf("[%s] Error loading stability state: %v\n", ts, err)
+        return 0, fmt.Errorf("loading stability state: %w", err)
+    }
+    schemas, err := loadSchemas(ws)
+    if err != nil {
+        fmt.Printf("[%s] Error loading schemas: %v\n", ts, err)
+        return 0, fmt.Errorf("loading schemas: %w", err)
+    }
+    var quorum *QuorumReport
+    var splitLog []shiftEntry
+    if len(ws.Mirrors) > 0 && ctx.Err() == nil {
+        quorum, splitLog = runQuorum(ctx, ws, fetched, source, outcomes, store, ts)
+    }
+    var cloaking []CloakingFile
+    var cloakLog []shiftEntry
+    if len(ws.Cloaking.Profiles) > 0 && ctx.Err() == nil {
+        cloaking, cloakLog = runCloakingCheck(ctx, ws, fetched, outcomes, store, ts)
+    }
+    if ctx.Err() != nil {
+        fmt.Printf("[%s] Cycle cancelled before completion, nothing recorded\n", ts)
+        return 0, ctx.Err()
+    }
+
+    var results []fileResult
+    shiftLog := historyLog
+    shifts, tamperedCount := 0, 0
+    commit := ""
+
+    // Hash new remote files first so a tracked file that disappeared can be
+    // matched to the name its content moved to.
+    addedOutcomes := outcomes[len(filenames):]
+    addedHashes := make([]string, len(added))
+    addedByHash := map[string]string{}
+    renamedFrom := map[string]string{}
+    for i, name := range added {
+        remote := addedOutcomes[i].Remote
+        if addedOutcomes[i].Err != nil || remote.StatusCode != http.StatusOK {
+            continue
+        }
+        hash, err := store.put(remote.Body)
+        if err != nil {
+            fmt.Printf("[%s] %s: Store object failed: %v\n", ts, name, err)
+            hash = sha256Hex(remote.Body)
+        }
+        addedHashes[i] = hash
+        if _, ok := addedByHash[hash]; !ok {
+            addedByHash[hash] = name
+        }
+    }
 
     for i, originalFilename := range filenames {
-        localPath := filepath.Join(runningDir, originalFilename)
-        encodedFilename := url.PathEscape(originalFilename)
-        rawURL := baseURL + encodedFilename + "?t=" + randomTimestamp()
+        localPath := filepath.Join(ws.Dir, originalFilename)
 
-        if i > 0 {
-            time.Sleep(fetchPause)
+        result := fileResult{Name: originalFilename, Hash: zeroHash, Local: "untracked"}
+        localHash, localErr := fileHash(localPath)
+        baselineHash := localHash
+        entry := manifest.Files[originalFilename]
+        if entry != nil {
+            baselineHash = entry.SHA256
+            result.Local = "ok"
+            if localErr != nil || localHash != entry.SHA256 {
+                result.Local = "modified"
+                local := localHash
+                if os.IsNotExist(localErr) {
+                    result.Local, local = "missing", "missing"
+                } else if localErr != nil {
+                    local = "error: " + localErr.Error()
+                }
+                tamperedCount++
+                if stability.tampered(originalFilename, local) {
+                    tamperText := describeTampering(ts, originalFilename, localHash, localErr, entry)
+                    fmt.Printf("[%s] %s: LOCAL TAMPERING DETECTED! Local file does not match the baseline manifest\n", ts, originalFilename)
+                    shiftLog = append(shiftLog, shiftEntry{File: originalFilename, Kind: "tamper", Text: tamperText})
+                } else {
+                    fmt.Printf("[%s] %s: Local file still does not match the baseline manifest (already logged)\n", ts, originalFilename)
+                }
+            } else {
+                stability.tampered(originalFilename, "")
+            }
+        } else if localErr != nil {
+            fmt.Printf("[%s] %s: Local hash failed: %v\n", ts, originalFilename, localErr)
+            result.Status = "error"
+            result.Detail = "local hash failed: " + localErr.Error()
+            results = append(results, result)
+            continue
         }
 
-        var rawHash string
-        var body []byte
         var diffText string
 
-        client := &http.Client{
-            Timeout: 30 * time.Second,
-        }
-        req, err := http.NewRequest("GET", rawURL, nil)
+        remote, err := outcomes[i].Remote, outcomes[i].Err
         if err != nil {
-            fmt.Printf("[%s] %s: Request failed: %v (URL: %s)\n", ts, originalFilename, err, rawURL)
-            rawHash = zeroHash
+            result.Status = fetchStatus(err)
+            result.Detail = err.Error() + outcomes[i].attemptsDetail()
+            fmt.Printf("[%s] %s: Fetch failed (%s%s): %v (URL: %s)\n", ts, originalFilename, result.Status, outcomes[i].attemptsDetail(), err, source.Location(originalFilename))
+            diffText = fmt.Sprintf("[%s] %s: Remote check failed - %s: %s (URL: %s)\n", ts, originalFilename, result.Status, result.Detail, source.Location(originalFilename))
+            shiftLog = append(shiftLog, shiftEntry{File: originalFilename, Kind: result.Status, Text: diffText})
+            results = append(results, result)
             continue
         }
-        req.Header.Set("User-Agent", "Googlebot/2.1; +http://www.google.com/bot.html")
-        req.Header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
-        req.Header.Set("Pragma", "no-cache")
-        req.Header.Set("Expires", "0")
-        req.Header.Set("If-Modified-Since", "Thu, 01 Jan 1970 00:00:00 GMT")
-        req.Header.Set("If-None-Match", "")
-        req.Header.Set("Connection", "close")
-        req.Header.Del("Accept-Encoding")
-
-        resp, err := client.Do(req)
-        if err != nil {
-            fmt.Printf("[%s] %s: Fetch failed: %v (URL: %s)\n", ts, originalFilename, err, rawURL)
-            rawHash = zeroHash
+
+        gone := remote.StatusCode == http.StatusNotFound || remote.StatusCode == http.StatusGone
+        if newName, ok := addedByHash[baselineHash]; ok && gone && renamedFrom[newName] == "" {
+            renamedFrom[newName] = originalFilename
+            fmt.Printf("[%s] %s: SHIFT DETECTED! Renamed upstream to %s\n", ts, originalFilename, newName)
+            diffText = fmt.Sprintf("[%s] %s: Renamed upstream to %s (content unchanged, sha256 %s)\n", ts, originalFilename, newName, baselineHash)
+            shiftLog = append(shiftLog, shiftEntry{File: originalFilename, Kind: "renamed", Text: diffText})
+            shifts++
+            result.Status = "renamed"
+            result.Detail = "renamed to " + newName
+            results = append(results, result)
             continue
         }
-        defer resp.Body.Close()
 
-        if resp.StatusCode != http.StatusOK {
-            fmt.Printf("[%s] %s: SHIFT DETECTED! Remote unavailable (HTTP %d) (URL: %s)\n", ts, originalFilename, resp.StatusCode, rawURL)
-            diffText = fmt.Sprintf("[%s] %s: Remote unavailable (HTTP %d) - potential deletion or rename (URL: %s)\n", ts, originalFilename, resp.StatusCode, rawURL)
-            shiftLog = append(shiftLog, diffText)
-            rawHash = zeroHash
+        if gone && listed != nil && !hasName(listed, originalFilename) {
+            fmt.Printf("[%s] %s: SHIFT DETECTED! Deleted upstream (HTTP %d) (URL: %s)\n", ts, originalFilename, remote.StatusCode, remote.URL)
+            diffText = fmt.Sprintf("[%s] %s: Deleted upstream - no longer listed and HTTP %d (URL: %s)\n", ts, originalFilename, remote.StatusCode, remote.URL)
+            shiftLog = append(shiftLog, shiftEntry{File: originalFilename, Kind: "deleted", Text: diffText})
+            shifts++
+            result.Status = "deleted"
+            result.Detail = fmt.Sprintf("HTTP %d", remote.StatusCode)
+            results = append(results, result)
             continue
         }
 
-        body, err = io.ReadAll(resp.Body)
-        if err != nil {
-            fmt.Printf("[%s] %s: Read failed: %v\n", ts, originalFilename, err)
-            rawHash = zeroHash
+        if remote.StatusCode != http.StatusOK {
+            fmt.Printf("[%s] %s: SHIFT DETECTED! Remote unavailable (HTTP %d%s) (URL: %s)\n", ts, originalFilename, remote.StatusCode, outcomes[i].attemptsDetail(), remote.URL)
+            diffText = fmt.Sprintf("[%s] %s: Remote unavailable (HTTP %d%s) - potential deletion or rename (URL: %s)\n", ts, originalFilename, remote.StatusCode, outcomes[i].attemptsDetail(), remote.URL)
+            shiftLog = append(shiftLog, shiftEntry{File: originalFilename, Kind: "http-error", Text: diffText})
+            shifts++
+            result.Status = "http-error"
+            result.Detail = fmt.Sprintf("HTTP %d%s", remote.StatusCode, outcomes[i].attemptsDetail())
+            results = append(results, result)
             continue
         }
+        body := remote.Body
+        if remote.Commit != "" {
+            commit = remote.Commit
+        }
 
-        rawHash = sha256Hex(body)
-        localHash, localErr := fileHash(localPath)
-        if localErr != nil {
-            fmt.Printf("[%s] %s: Local hash failed: %v\n", ts, originalFilename, localErr)
-            continue
+        rawHash, err := store.put(body)
+        if err != nil {
+            fmt.Printf("[%s] %s: Store object failed: %v\n", ts, originalFilename, err)
+            rawHash = sha256Hex(body)
+        }
+        result.Hash = rawHash
+        result.Status = "ok"
+
+        basePath := localPath
+        if localHash != baselineHash && store.has(baselineHash) {
+            basePath = store.path(baselineHash)
+        }
+        describe := func(object string) string {
+            data, err := store.get(object)
+            if err != nil {
+                return fmt.Sprintf("[%s] %s: Transient content unavailable: %v\n", ts, originalFilename, err)
+            }
+            text := generateDiff(ws, originalFilename, basePath, data, ts)
+            if len(text) > ws.Diff.MaxChars {
+                text = text[:ws.Diff.MaxChars] + "... (truncated)"
+            }
+            return text
+        }
+        settled := rawHash == baselineHash || entry != nil && entry.isRejected(rawHash)
+        alerted := stability.confirmed(originalFilename, rawHash)
+        seen, events := stability.observe(originalFilename, rawHash, settled, ts, describe)
+        for _, event := range events {
+            fmt.Printf("[%s] %s: %s detected (see log)\n", ts, originalFilename, strings.ToUpper(event.Kind))
         }
+        shiftLog = append(shiftLog, events...)
 
-        ext := strings.ToLower(filepath.Ext(originalFilename))
-        if rawHash == localHash {
+        if rawHash == baselineHash && remote.Revalidated {
+            fmt.Printf("[%s] %s: No change (hash: %s, confirmed without download)\n", ts, originalFilename, rawHash[:8])
+        } else if rawHash == baselineHash {
             fmt.Printf("[%s] %s: No change (hash: %s)\n", ts, originalFilename, rawHash[:8])
+        } else if entry != nil && entry.isRejected(rawHash) {
+            result.Status = "rejected"
+            fmt.Printf("[%s] %s: Known rejected version (hash: %s), not re-alerting\n", ts, originalFilename, rawHash[:8])
+        } else if alerted {
+            result.Status = "changed"
+            fmt.Printf("[%s] %s: Shift still unaccepted (hash: %s, seen %d cycles), already logged\n", ts, originalFilename, rawHash[:8], seen)
+        } else if seen < ws.Stability.Confirmations {
+            result.Status = "pending"
+            result.Detail = fmt.Sprintf("unconfirmed change, seen %d of %d cycles", seen, ws.Stability.Confirmations)
+            fmt.Printf("[%s] %s: Unconfirmed change (hash: %s, seen %d of %d cycles), waiting before alerting\n", ts, originalFilename, rawHash[:8], seen, ws.Stability.Confirmations)
         } else {
-            fmt.Printf("[%s] %s: SHIFT DETECTED! Logging diff to %s\n", ts, originalFilename, logFile)
-            if ext == ".csv" {
-                diffText = generateCSVDiff(localPath, body, ts, originalFilename)
-            } else if ext == ".pdf" {
-                diffText = generatePDFDiff(localPath, body, ts, originalFilename)
-            } else {
-                localExif, localOcr, exifErr, ocrErr := extractImageData(localPath)
-                remoteExif, remoteOcr, remoteExifErr, remoteOcrErr := extractImageDataFromBytes(body, originalFilename)
-
-                diffText = generateImageDiff(localPath, body, localExif, remoteExif, localOcr, remoteOcr, exifErr, remoteExifErr, ocrErr, remoteOcrErr, ts, originalFilename)
+            result.Status = "changed"
+            fmt.Printf("[%s] %s: SHIFT DETECTED! Logging diff\n", ts, originalFilename)
+            diffText = generateDiff(ws, originalFilename, basePath, body, ts)
+            if basePath == localPath && localHash != baselineHash {
+                diffText = fmt.Sprintf("[%s] %s: Remote differs from manifest hash %s (diff below is against the modified local copy)\n", ts, originalFilename, baselineHash) + diffText
             }
-            if len(diffText) > maxDiffChars {
-                diffText = diffText[:maxDiffChars] + "... (truncated)"
+            if remote.StaleValidators {
+                diffText = fmt.Sprintf("[%s] %s: Server kept the old ETag/Last-Modified for new content; cheap checks missed this change\n", ts, originalFilename) + diffText
             }
-            shiftLog = append(shiftLog, diffText)
-
-            changedPath := filepath.Join(runningDir, originalFilename+"_"+strings.ReplaceAll(ts, " ", "_")+".changed")
-            err = os.WriteFile(changedPath, body, 0644)
-            if err != nil {
-                fmt.Printf("[%s] %s: Save changed file failed: %v\n", ts, originalFilename, err)
+            if len(diffText) > ws.Diff.MaxChars {
+                diffText = diffText[:ws.Diff.MaxChars] + "... (truncated)"
+            }
+            shiftLog = append(shiftLog, shiftEntry{File: originalFilename, Kind: "shift", Text: diffText})
+            shifts++
+            if ws.fileType(originalFilename) == "csv" {
+                shiftLog = append(shiftLog, csvFindings(ws, schemas, originalFilename, baselineHash, basePath, body, ts)...)
             }
         }
 
-        unifiedBuilder.WriteString(rawHash)
-    }
-
-    if len(shiftLog) > 0 {
-        logFileHandle, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-        if err != nil {
-            fmt.Printf("[%s] Error opening log file: %v\n", ts, err)
-        } else {
-            for _, diff := range shiftLog {
-                logFileHandle.WriteString(diff + "\n")
+        results = append(results, result)
+    }
+
+    for i, name := range added {
+        result := fileResult{Name: name, Hash: zeroHash, Local: "absent"}
+        remote, err := addedOutcomes[i].Remote, addedOutcomes[i].Err
+        switch {
+        case err != nil:
+            result.Status = fetchStatus(err)
+            result.Detail = err.Error() + addedOutcomes[i].attemptsDetail()
+            fmt.Printf("[%s] %s: Fetch of new remote file failed (%s): %v\n", ts, name, result.Status, err)
+        case remote.StatusCode != http.StatusOK:
+            fmt.Printf("[%s] %s: Listed upstream but HTTP %d (URL: %s)\n", ts, name, remote.StatusCode, remote.URL)
+            result.Status = "http-error"
+            result.Detail = fmt.Sprintf("HTTP %d%s", remote.StatusCode, addedOutcomes[i].attemptsDetail())
+        default:
+            if remote.Commit != "" {
+                commit = remote.Commit
+            }
+            result.Hash = addedHashes[i]
+            result.Status = "added"
+            if from := renamedFrom[name]; from != "" {
+                result.Detail = "renamed from " + from
+                break
             }
-            logFileHandle.Close()
+            if !stability.added(name, result.Hash) {
+                fmt.Printf("[%s] %s: New file upstream still untracked (hash: %s), already logged\n", ts, name, result.Hash[:8])
+                break
+            }
+            fmt.Printf("[%s] %s: SHIFT DETECTED! New file upstream (hash: %s)\n", ts, name, result.Hash[:8])
+            text := fmt.Sprintf("[%s] %s: Added upstream (sha256 %s, %d bytes, URL: %s); run `accept %s` to start tracking it\n", ts, name, result.Hash, len(remote.Body), remote.URL, name)
+            shiftLog = append(shiftLog, shiftEntry{File: name, Kind: "added", Text: text})
+            shifts++
         }
+        results = append(results, result)
     }
 
-    unifiedHash := sha256Hex([]byte(unifiedBuilder.String()))
-    fmt.Printf("[%s] Cycle complete for %d files\n", ts, len(filenames))
-    fmt.Printf("[%s] Unified Hash: 0x%s\n", ts, unifiedHash)
-}
+    shiftLog = append(append(shiftLog, splitLog...), cloakLog...)
+    if err := saveSourceState(ws, source); err != nil {
+        fmt.Printf("[%s] Error saving source state: %v\n", ts, err)
+    }
+    if err := stability.save(ws); err != nil {
+        fmt.Printf("[%s] Error saving stability state: %v\n", ts, err)
+    }
+    if err := schemas.save(ws); err != nil {
+        fmt.Printf("[%s] Error saving schemas: %v\n", ts, err)
+    }
+    logHead := writeOutputs(ws, ts, shiftLog)
 
-func generateCSVDiff(localPath string, remoteData []byte, ts, filename string) string {
-    localCSV, err := parseCSV(localPath)
-    if err != nil {
-        return fmt.Sprintf("[%s] CSV: %s | Error parsing local: %v", ts, filename, err)
+    fmt.Printf("[%s] Cycle complete for %d files (%d remote shifts, %d locally tampered)\n", ts, len(results), shifts, tamperedCount)
+    if len(historyLog) > 0 {
+        fmt.Printf("[%s] %d git history alerts for %s\n", ts, len(historyLog), source)
     }
-    remoteCSV, err := parseCSVFromBytes(remoteData)
+    leaves := resultLeaves(receiptVersion, results)
+    root, err := merkleRoot(leaves)
     if err != nil {
-        return fmt.Sprintf("[%s] CSV: %s | Error parsing remote: %v", ts, filename, err)
+        fmt.Printf("[%s] Error computing Merkle root: %v\n", ts, err)
+        return shifts, fmt.Errorf("computing Merkle root: %w", err)
+    }
+    fmt.Printf("[%s] Unified Hash (Merkle root): 0x%s\n", ts, root)
+
+    completedAt := time.Now().UTC()
+    var indexEntries []IndexEntry
+    for _, r := range results {
+        entry := IndexEntry{Cycle: startedAt.Format(time.RFC3339Nano), Time: completedAt, File: r.Name, Status: r.Status}
+        if r.Hash != zeroHash {
+            entry.Object = r.Hash
+            entry.Commit = commit
+        }
+        indexEntries = append(indexEntries, entry)
     }
-
-    var diff strings.Builder
-    diff.WriteString(fmt.Sprintf("[%s] Diff for %s\n", ts, filename))
-
-    addedCount, omittedCount, modifiedCount := 0, 0, 0
-    maxChanges := maxDiffChanges
-
-    maxRows := len(localCSV)
-    if len(remoteCSV) > maxRows {
-        maxRows = len(remoteCSV)
+    if err := appendIndex(ws, indexEntries); err != nil {
+        fmt.Printf("[%s] Error writing index: %v\n", ts, err)
     }
 
-    for i := 0; i < maxRows && addedCount+omittedCount+modifiedCount < maxChanges; i++ {
-        localRow := []string{}
-        if i < len(localCSV) {
-            localRow = localCSV[i]
-        }
-        remoteRow := []string{}
-        if i < len(remoteCSV) {
-            remoteRow = remoteCSV[i]
-        }
+    record := &CycleRecord{WatchSet: ws.Name, Time: completedAt, Root: root, Leaves: sortLeaves(leaves)}
+    if err := saveCycleRecord(ws, record); err != nil {
+        fmt.Printf("[%s] Error saving cycle record: %v\n", ts, err)
+    }
 
-        if len(localRow) == 0 {
-            addedCount++
-            diff.WriteString(fmt.Sprintf("Added row %d: %s\n", i+1, strings.Join(remoteRow, ",")))
-        } else if len(remoteRow) == 0 {
-            omittedCount++
-            diff.WriteString(fmt.Sprintf("Omitted row %d: %s\n", i+1, strings.Join(localRow, ",")))
+    receipt := &Receipt{
+        Version:     receiptVersion,
+        WatchSet:    ws.Name,
+        Remote:      source.String(),
+        Commit:      commit,
+        StartedAt:   startedAt,
+        CompletedAt: completedAt,
+        Root:        root,
+        Files:       results,
+        LogHead:     logHead,
+        Quorum:      quorum,
+        Cloaking:    cloaking,
+    }
+    if path, err := writeReceipt(ws, receipt); err != nil {
+        if os.IsNotExist(err) {
+            fmt.Printf("[%s] No signing key at %s; run `keygen` to sign cycle receipts\n", ts, ws.SigningKey)
         } else {
-            maxCols := len(localRow)
-            if len(remoteRow) > maxCols {
-                maxCols = len(remoteRow)
-            }
-            for j := 0; j < maxCols; j++ {
-                localField := ""
-                if j < len(localRow) {
-                    localField = localRow[j]
-                }
-                remoteField := ""
-                if j < len(remoteRow) {
-                    remoteField = remoteRow[j]
-                }
-                if localField != remoteField {
-                    modifiedCount++
-                    diff.WriteString(fmt.Sprintf("Modified field in row %d, col %d: '%s' → '%s'\n", i+1, j+1, localField, remoteField))
-                    break
-                }
-            }
+            fmt.Printf("[%s] Error writing receipt: %v\n", ts, err)
         }
+    } else {
+        fmt.Printf("[%s] Signed receipt: %s\n", ts, path)
     }
+    return shifts, nil
+}
 
-    if addedCount+omittedCount+modifiedCount == 0 {
-        diff.WriteString("No specific changes identified (full content mismatch)\n")
+func generateDiff(ws *WatchSet, filename, basePath string, body []byte, ts string) string {
+    switch ws.fileType(filename) {
+    case "csv":
+        return generateCSVDiff(basePath, body, ts, filename, ws.Diff.CSV)
+    case "pdf":
+        return generatePDFDiff(basePath, body, ts, filename)
     }
 
-    return diff.String()
+    var localExif, localOcr string
+    var exifErr, ocrErr error
+    if strings.EqualFold(filepath.Ext(basePath), filepath.Ext(filename)) {
+        localExif, localOcr, exifErr, ocrErr = extractImageData(basePath, ws.Diff.Image)
+    } else if baseData, err := os.ReadFile(basePath); err != nil {
+        exifErr, ocrErr = err, err
+    } else {
+        localExif, localOcr, exifErr, ocrErr = extractImageDataFromBytes(baseData, filename, ws.Diff.Image)
+    }
+    remoteExif, remoteOcr, remoteExifErr, remoteOcrErr := extractImageDataFromBytes(body, filename, ws.Diff.Image)
+
+    return generateImageDiff(basePath, body, localExif, remoteExif, localOcr, remoteOcr, exifErr, remoteExifErr, ocrErr, remoteOcrErr, ts, filename, ws.Diff.Image.MaxChanges)
+}
+
+func describeTampering(ts, filename, localHash string, localErr error, entry *ManifestEntry) string {
+    if localErr != nil {
+        if os.IsNotExist(localErr) {
+            return fmt.Sprintf("[%s] %s: Local tampering - baseline file is missing (manifest=%s)\n", ts, filename, entry.SHA256)
+        }
+        return fmt.Sprintf("[%s] %s: Local tampering - baseline file unreadable: %v (manifest=%s)\n", ts, filename, localErr, entry.SHA256)
+    }
+    return fmt.Sprintf("[%s] %s: Local tampering - file no longer matches manifest (local=%s, manifest=%s, fetched %s)\n", ts, filename, localHash, entry.SHA256, entry.FetchedAt.Format(time.RFC3339))
 }
 
 func generatePDFDiff(localPath string, remoteData []byte, ts, filename string) string {
@@ -405,14 +635,13 @@ func generatePDFDiff(localPath string, remoteData []byte, ts, filename string) s
     return fmt.Sprintf("[%s] PDF Diff for %s\nFile Hash: Local=%s, Remote=%s\n", ts, filename, localHash, remoteHash)
 }
 
-func generateTextDiff(localText, remoteText, section string) string {
+func generateTextDiff(localText, remoteText, section string, maxChanges int) string {
     var diff strings.Builder
 
     localLines := strings.Split(localText, "\n")
     remoteLines := strings.Split(remoteText, "\n")
 
     addedCount, omittedCount, modifiedCount := 0, 0, 0
-    maxChanges := maxDiffChanges
 
     maxLines := len(localLines)
     if len(remoteLines) > maxLines {
@@ -448,7 +677,7 @@ func generateTextDiff(localText, remoteText, section string) string {
     return diff.String()
 }
 
-func generateImageDiff(localPath string, remoteData []byte, localExif, remoteExif, localOcr, remoteOcr string, localExifErr, remoteExifErr, localOcrErr, remoteOcrErr error, ts, filename string) string {
+func generateImageDiff(localPath string, remoteData []byte, localExif, remoteExif, localOcr, remoteOcr string, localExifErr, remoteExifErr, localOcrErr, remoteOcrErr error, ts, filename string, maxChanges int) string {
     var diff strings.Builder
     diff.WriteString(fmt.Sprintf("[%s] Image Diff for %s\n", ts, filename))
 
@@ -465,7 +694,7 @@ func generateImageDiff(localPath string, remoteData []byte, localExif, remoteExi
     if localExifErr == nil && remoteExifErr == nil {
         if localExif != remoteExif {
             diff.WriteString("EXIF Changed:\n")
-            diff.WriteString(generateTextDiff(localExif, remoteExif, "EXIF"))
+            diff.WriteString(generateTextDiff(localExif, remoteExif, "EXIF", maxChanges))
         } else {
             diff.WriteString("EXIF Unchanged\n")
         }
@@ -484,7 +713,7 @@ func generateImageDiff(localPath string, remoteData []byte, localExif, remoteExi
     if localOcrErr == nil && remoteOcrErr == nil {
         if localOcr != remoteOcr {
             diff.WriteString("OCR Text Changed:\n")
-            diff.WriteString(generateTextDiff(localOcr, remoteOcr, "OCR"))
+            diff.WriteString(generateTextDiff(localOcr, remoteOcr, "OCR", maxChanges))
         } else {
             diff.WriteString("OCR Text Unchanged\n")
         }
@@ -497,17 +726,6 @@ func generateImageDiff(localPath string, remoteData []byte, localExif, remoteExi
     return diff.String()
 }
 
-func parseCSV(path string) ([][]string, error) {
-    f, err := os.Open(path)
-    if err != nil {
-        return nil, err
-    }
-    defer f.Close()
-
-    reader := csv.NewReader(f)
-    return reader.ReadAll()
-}
-
 func parseCSVFromBytes(data []byte) ([][]string, error) {
     reader := csv.NewReader(strings.NewReader(string(data)))
     return reader.ReadAll()
@@ -534,7 +752,7 @@ func sha256Hex(b []byte) string {
     return hex.EncodeToString(h.Sum(nil))
 }
 
-func extractImageData(localPath string) (exifData, ocrText string, exifErr, ocrErr error) {
+func extractImageData(localPath string, opts ImageDiffConfig) (exifData, ocrText string, exifErr, ocrErr error) {
     ext := strings.ToLower(filepath.Ext(localPath))
 
     f, err := os.Open(localPath)
@@ -543,8 +761,13 @@ func extractImageData(localPath string) (exifData, ocrText string, exifErr, ocrE
         return
     }
     defer f.Close()
-    exifData, exifErr = extractExif(f)
+    if *opts.EXIF {
+        exifData, exifErr = extractExif(f)
+    }
 
+    if !*opts.OCR {
+        return
+    }
     if ext == ".avif" {
         ocrErr = fmt.Errorf("AVIF format not supported for OCR")
         return
@@ -558,7 +781,7 @@ func extractImageData(localPath string) (exifData, ocrText string, exifErr, ocrE
     return exifData, ocrText, exifErr, ocrErr
 }
 
-func extractImageDataFromBytes(data []byte, filename string) (exifData, ocrText string, exifErr, ocrErr error) {
+func extractImageDataFromBytes(data []byte, filename string, opts ImageDiffConfig) (exifData, ocrText string, exifErr, ocrErr error) {
     ext := strings.ToLower(filepath.Ext(filename))
 
     tempFile := filepath.Join(os.TempDir(), "remote_"+filename)
@@ -576,8 +799,13 @@ func extractImageDataFromBytes(data []byte, filename string) (exifData, ocrText
         return
     }
     defer f.Close()
-    exifData, exifErr = extractExif(f)
+    if *opts.EXIF {
+        exifData, exifErr = extractExif(f)
+    }
 
+    if !*opts.OCR {
+        return
+    }
     if ext == ".avif" {
         ocrErr = fmt.Errorf("AVIF format not supported for OCR")
         return
@@ -0,0 +1,102 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+const manifestFile = "manifest.json"
+
+type Manifest struct {
+    WatchSet string                    `json:"watch_set"`
+    Remote   string                    `json:"remote"`
+    Created  time.Time                 `json:"created"`
+    Updated  time.Time                 `json:"updated"`
+    Files    map[string]*ManifestEntry `json:"files"`
+}
+
+type ManifestEntry struct {
+    SHA256    string      `json:"sha256"`
+    Size      int64       `json:"size"`
+    FetchedAt time.Time   `json:"fetched_at"`
+    SourceURL string      `json:"source_url"`
+    Headers   http.Header `json:"headers,omitempty"`
+    Commit    string      `json:"commit,omitempty"`
+    Accepted  *Decision   `json:"accepted,omitempty"`
+    Rejected  []Decision  `json:"rejected,omitempty"`
+}
+
+func manifestPath(ws *WatchSet) string {
+    return filepath.Join(ws.StateDir, manifestFile)
+}
+
+func loadManifest(ws *WatchSet) (*Manifest, error) {
+    data, err := os.ReadFile(manifestPath(ws))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return &Manifest{WatchSet: ws.Name, Remote: ws.source().String(), Files: map[string]*ManifestEntry{}}, nil
+        }
+        return nil, err
+    }
+
+    var m Manifest
+    if err := json.Unmarshal(data, &m); err != nil {
+        return nil, fmt.Errorf("%s: %v", manifestPath(ws), err)
+    }
+    if m.Files == nil {
+        m.Files = map[string]*ManifestEntry{}
+    }
+    return &m, nil
+}
+
+func saveManifest(ws *WatchSet, m *Manifest) error {
+    now := time.Now().UTC()
+    if m.Created.IsZero() {
+        m.Created = now
+    }
+    m.Updated = now
+    m.WatchSet = ws.Name
+    m.Remote = ws.source().String()
+
+    data, err := json.MarshalIndent(m, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(manifestPath(ws), append(data, '\n'))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
+
+func (m *Manifest) names() []string {
+    names := make([]string, 0, len(m.Files))
+    for name := range m.Files {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func (m *Manifest) record(filename string, remote *remoteFile) {
+    m.Files[filename] = &ManifestEntry{
+        SHA256:    sha256Hex(remote.Body),
+        Size:      int64(len(remote.Body)),
+        FetchedAt: time.Now().UTC(),
+        SourceURL: remote.URL,
+        Headers:   remote.Header,
+        Commit:    remote.Commit,
+    }
+}
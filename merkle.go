@@ -0,0 +1,227 @@
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+)
+
+// The unified hash is the root of a Merkle tree over one leaf per watched
+// file, following the RFC 6962 tree shape:
+//
+//   leaf      = SHA-256(0x00 || uint32be(len(name)) || name || content)
+//   node      = SHA-256(0x01 || left || right)
+//   empty set = SHA-256("")
+//
+// name is the UTF-8 filename relative to the watch set directory and content
+// is the raw 32-byte SHA-256 of the file body. A file that could not be
+// fetched gets SHA-256("status:" || status) instead, e.g. "status:timeout",
+// so the root also commits to why content is missing. Leaves are sorted by
+// name (byte order) before the tree is built, and a tree of n > 1 leaves is
+// split at the largest power of two smaller than n, so proofs are ordinary
+// RFC 6962 audit paths.
+
+const cycleFile = "last_cycle.json"
+
+type merkleLeaf struct {
+    Name string `json:"name"`
+    Hash string `json:"hash"`
+}
+
+type MerkleProof struct {
+    Root     string     `json:"root"`
+    TreeSize int        `json:"tree_size"`
+    Index    int        `json:"index"`
+    Leaf     merkleLeaf `json:"leaf"`
+    Path     []string   `json:"path"`
+}
+
+type CycleRecord struct {
+    WatchSet string       `json:"watch_set"`
+    Time     time.Time    `json:"time"`
+    Root     string       `json:"root"`
+    Leaves   []merkleLeaf `json:"leaves"`
+}
+
+func sortLeaves(leaves []merkleLeaf) []merkleLeaf {
+    sorted := append([]merkleLeaf(nil), leaves...)
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+    return sorted
+}
+
+func statusLeafHash(status string) string {
+    return sha256Hex([]byte("status:" + status))
+}
+
+func merkleLeafHash(leaf merkleLeaf) ([]byte, error) {
+    content, err := hex.DecodeString(leaf.Hash)
+    if err != nil || len(content) != sha256.Size {
+        return nil, fmt.Errorf("%s: invalid sha256 %q", leaf.Name, leaf.Hash)
+    }
+
+    h := sha256.New()
+    h.Write([]byte{0x00})
+    var nameLen [4]byte
+    binary.BigEndian.PutUint32(nameLen[:], uint32(len(leaf.Name)))
+    h.Write(nameLen[:])
+    h.Write([]byte(leaf.Name))
+    h.Write(content)
+    return h.Sum(nil), nil
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+    h := sha256.New()
+    h.Write([]byte{0x01})
+    h.Write(left)
+    h.Write(right)
+    return h.Sum(nil)
+}
+
+func merkleSplit(n int) int {
+    k := 1
+    for k<<1 < n {
+        k <<= 1
+    }
+    return k
+}
+
+func merkleTreeHash(hashes [][]byte) []byte {
+    switch len(hashes) {
+    case 0:
+        empty := sha256.Sum256(nil)
+        return empty[:]
+    case 1:
+        return hashes[0]
+    }
+    k := merkleSplit(len(hashes))
+    return merkleNodeHash(merkleTreeHash(hashes[:k]), merkleTreeHash(hashes[k:]))
+}
+
+func merkleAuditPath(index int, hashes [][]byte) [][]byte {
+    if len(hashes) <= 1 {
+        return nil
+    }
+    k := merkleSplit(len(hashes))
+    if index < k {
+        return append(merkleAuditPath(index, hashes[:k]), merkleTreeHash(hashes[k:]))
+    }
+    return append(merkleAuditPath(index-k, hashes[k:]), merkleTreeHash(hashes[:k]))
+}
+
+func leafHashes(leaves []merkleLeaf) ([][]byte, error) {
+    hashes := make([][]byte, len(leaves))
+    for i, leaf := range leaves {
+        h, err := merkleLeafHash(leaf)
+        if err != nil {
+            return nil, err
+        }
+        hashes[i] = h
+    }
+    return hashes, nil
+}
+
+func merkleRoot(leaves []merkleLeaf) (string, error) {
+    hashes, err := leafHashes(sortLeaves(leaves))
+    if err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(merkleTreeHash(hashes)), nil
+}
+
+func merkleProve(leaves []merkleLeaf, name string) (*MerkleProof, error) {
+    sorted := sortLeaves(leaves)
+    hashes, err := leafHashes(sorted)
+    if err != nil {
+        return nil, err
+    }
+
+    index := -1
+    for i, leaf := range sorted {
+        if leaf.Name == name {
+            index = i
+            break
+        }
+    }
+    if index < 0 {
+        return nil, fmt.Errorf("%s is not a leaf of this tree", name)
+    }
+
+    proof := &MerkleProof{
+        Root:     hex.EncodeToString(merkleTreeHash(hashes)),
+        TreeSize: len(sorted),
+        Index:    index,
+        Leaf:     sorted[index],
+    }
+    for _, p := range merkleAuditPath(index, hashes) {
+        proof.Path = append(proof.Path, hex.EncodeToString(p))
+    }
+    return proof, nil
+}
+
+func verifyMerkleProof(proof *MerkleProof) error {
+    if proof.Index < 0 || proof.Index >= proof.TreeSize {
+        return fmt.Errorf("index %d out of range for tree size %d", proof.Index, proof.TreeSize)
+    }
+    r, err := merkleLeafHash(proof.Leaf)
+    if err != nil {
+        return err
+    }
+
+    fn, sn := proof.Index, proof.TreeSize-1
+    for _, hexNode := range proof.Path {
+        p, err := hex.DecodeString(hexNode)
+        if err != nil || len(p) != sha256.Size {
+            return fmt.Errorf("invalid path node %q", hexNode)
+        }
+        if sn == 0 {
+            return fmt.Errorf("proof path is longer than the tree is deep")
+        }
+        if fn&1 == 1 || fn == sn {
+            r = merkleNodeHash(p, r)
+            for fn&1 == 0 && fn != 0 {
+                fn >>= 1
+                sn >>= 1
+            }
+        } else {
+            r = merkleNodeHash(r, p)
+        }
+        fn >>= 1
+        sn >>= 1
+    }
+    if sn != 0 {
+        return fmt.Errorf("proof path is shorter than the tree is deep")
+    }
+
+    root, err := hex.DecodeString(proof.Root)
+    if err != nil || !bytes.Equal(root, r) {
+        return fmt.Errorf("computed root %x does not match %s", r, proof.Root)
+    }
+    return nil
+}
+
+func saveCycleRecord(ws *WatchSet, record *CycleRecord) error {
+    data, err := json.MarshalIndent(record, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(filepath.Join(ws.StateDir, cycleFile), append(data, '\n'))
+}
+
+func loadCycleRecord(ws *WatchSet) (*CycleRecord, error) {
+    data, err := os.ReadFile(filepath.Join(ws.StateDir, cycleFile))
+    if err != nil {
+        return nil, err
+    }
+    var record CycleRecord
+    if err := json.Unmarshal(data, &record); err != nil {
+        return nil, err
+    }
+    return &record, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+    "crypto/sha256"
+    "fmt"
+    "testing"
+)
+
+func testLeaves(n int) []merkleLeaf {
+    leaves := make([]merkleLeaf, n)
+    for i := range leaves {
+        leaves[i] = merkleLeaf{Name: fmt.Sprintf("file%d.csv", i), Hash: sha256Hex([]byte(fmt.Sprintf("content %d", i)))}
+    }
+    return leaves
+}
+
+func TestMerkleEmptyTree(t *testing.T) {
+    root, err := merkleRoot(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := sha256Hex(nil); root != want {
+        t.Errorf("empty root = %s, want %s", root, want)
+    }
+    if _, err := merkleProve(nil, "file0.csv"); err == nil {
+        t.Error("proved a leaf of the empty tree")
+    }
+}
+
+func TestMerkleProofs(t *testing.T) {
+    for n := 1; n <= 9; n++ {
+        leaves := testLeaves(n)
+        root, err := merkleRoot(leaves)
+        if err != nil {
+            t.Fatal(err)
+        }
+        for i, leaf := range leaves {
+            proof, err := merkleProve(leaves, leaf.Name)
+            if err != nil {
+                t.Fatalf("size %d, %s: %v", n, leaf.Name, err)
+            }
+            if proof.Root != root || proof.TreeSize != n || proof.Index != i {
+                t.Fatalf("size %d, %s: proof for root %s size %d index %d, want %s %d %d", n, leaf.Name, proof.Root, proof.TreeSize, proof.Index, root, n, i)
+            }
+
+            tests := []struct {
+                name   string
+                mutate func(p *MerkleProof)
+                ok     bool
+            }{
+                {"valid", func(p *MerkleProof) {}, true},
+                {"path too long", func(p *MerkleProof) { p.Path = append(p.Path, p.Root) }, false},
+                {"path too short", func(p *MerkleProof) {
+                    if len(p.Path) > 0 {
+                        p.Path = p.Path[:len(p.Path)-1]
+                    } else {
+                        p.TreeSize++
+                    }
+                }, false},
+                {"wrong index", func(p *MerkleProof) {
+                    if p.TreeSize > 1 {
+                        p.Index = (p.Index + 1) % p.TreeSize
+                    } else {
+                        p.Index = 1
+                    }
+                }, false},
+                {"negative index", func(p *MerkleProof) { p.Index = -1 }, false},
+                {"tampered leaf", func(p *MerkleProof) { p.Leaf.Hash = sha256Hex([]byte("tampered")) }, false},
+                {"renamed leaf", func(p *MerkleProof) { p.Leaf.Name += ".bak" }, false},
+            }
+            for _, tt := range tests {
+                p := *proof
+                p.Path = append([]string(nil), proof.Path...)
+                tt.mutate(&p)
+                err := verifyMerkleProof(&p)
+                if tt.ok && err != nil {
+                    t.Errorf("size %d, index %d, %s: %v", n, i, tt.name, err)
+                }
+                if !tt.ok && err == nil {
+                    t.Errorf("size %d, index %d, %s: proof verified", n, i, tt.name)
+                }
+            }
+        }
+    }
+}
+
+func TestMerkleAuditPathLength(t *testing.T) {
+    // RFC 6962 paths are ceil(log2(n)) long for the leftmost leaf.
+    want := []int{0, 0, 1, 2, 2, 3, 3, 3, 3, 4}
+    for n := 0; n <= 9; n++ {
+        hashes := make([][]byte, n)
+        for i := range hashes {
+            h := sha256.Sum256([]byte{byte(i)})
+            hashes[i] = h[:]
+        }
+        if got := len(merkleAuditPath(0, hashes)); got != want[n] {
+            t.Errorf("size %d: path length %d, want %d", n, got, want[n])
+        }
+    }
+}
+
+func TestMerkleStatusLeaf(t *testing.T) {
+    leaf := merkleLeaf{Name: "gone.csv", Hash: statusLeafHash("timeout")}
+    proof, err := merkleProve(append(testLeaves(3), leaf), leaf.Name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := verifyMerkleProof(proof); err != nil {
+        t.Error(err)
+    }
+}
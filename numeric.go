@@ -0,0 +1,159 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// number is a field read as a quantity: "6.674e-11", "9,192,631,770",
+// "$1,200.50" or "299792458 m/s". Unit holds any currency prefix and unit
+// suffix so that "5 km" and "5 m" are not taken to be equal.
+type number struct {
+    Value float64
+    Unit  string
+}
+
+// unitSuffixes may follow a number directly; any other unit needs a space
+// before it, so "0x10" or "3rd" are not read as numbers with a unit.
+var unitSuffixes = map[string]bool{
+    "%": true, "‰": true, "°": true, "°C": true, "°F": true, "K": true,
+    "k": true, "M": true, "G": true, "bn": true,
+    "nm": true, "µm": true, "mm": true, "cm": true, "m": true, "km": true,
+    "mg": true, "g": true, "kg": true, "t": true,
+    "ns": true, "µs": true, "ms": true, "s": true, "h": true,
+    "Hz": true, "kHz": true, "MHz": true, "GHz": true,
+    "B": true, "KB": true, "MB": true, "GB": true, "TB": true,
+}
+
+func parseNumber(s string) (number, bool) {
+    s = strings.TrimSpace(s)
+    var n number
+    for _, sym := range []string{"$", "€", "£"} {
+        if strings.HasPrefix(s, sym) {
+            n.Unit = sym
+            s = strings.TrimSpace(s[len(sym):])
+            break
+        }
+    }
+    s = strings.Replace(s, "−", "-", 1)
+
+    i := 0
+    if i < len(s) && (s[i] == '+' || s[i] == '-') {
+        i++
+    }
+    digits := 0
+    var clean strings.Builder
+    clean.WriteString(s[:i])
+    for i < len(s) {
+        c := s[i]
+        if c >= '0' && c <= '9' {
+            clean.WriteByte(c)
+            digits++
+            i++
+            continue
+        }
+        // A comma only separates thousands when exactly three digits follow.
+        if c == ',' && digits > 0 && thousandsGroup(s[i+1:]) {
+            i++
+            continue
+        }
+        break
+    }
+    if i < len(s) && s[i] == '.' {
+        clean.WriteByte('.')
+        i++
+        for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+            clean.WriteByte(s[i])
+            digits++
+            i++
+        }
+    }
+    if digits == 0 {
+        return n, false
+    }
+    if i+1 < len(s) && (s[i] == 'e' || s[i] == 'E') {
+        j := i + 1
+        if s[j] == '+' || s[j] == '-' {
+            j++
+        }
+        if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+            for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+                j++
+            }
+            clean.WriteString(s[i:j])
+            i = j
+        }
+    }
+
+    unit := strings.TrimSpace(s[i:])
+    if unit != "" {
+        r := []rune(unit)[0]
+        if !unicode.IsLetter(r) && !strings.ContainsRune("%‰°µ", r) {
+            return n, false
+        }
+        if unit == s[i:] && !unitSuffixes[unit] {
+            return n, false
+        }
+        n.Unit = strings.TrimSpace(n.Unit + " " + unit)
+    }
+    v, err := strconv.ParseFloat(clean.String(), 64)
+    if err != nil {
+        return n, false
+    }
+    n.Value = v
+    return n, true
+}
+
+func thousandsGroup(s string) bool {
+    if len(s) < 3 || (len(s) > 3 && s[3] >= '0' && s[3] <= '9') {
+        return false
+    }
+    for i := 0; i < 3; i++ {
+        if s[i] < '0' || s[i] > '9' {
+            return false
+        }
+    }
+    return true
+}
+
+// fieldKind classifies a changed field.
+type fieldKind int
+
+const (
+    valueChanged fieldKind = iota
+    formatOnly
+    withinTolerance
+)
+
+// compareFields decides whether two differing field texts differ in value.
+// For numbers the returned note gives the absolute and relative change, and
+// the ratio when it is an order of magnitude or more.
+func compareFields(localField, remoteField string, tol ToleranceConfig) (fieldKind, string) {
+    a, okA := parseNumber(localField)
+    b, okB := parseNumber(remoteField)
+    if !okA || !okB {
+        return valueChanged, ""
+    }
+    if a.Unit != b.Unit {
+        return valueChanged, fmt.Sprintf("unit '%s' → '%s'", a.Unit, b.Unit)
+    }
+    if a.Value == b.Value {
+        return formatOnly, ""
+    }
+
+    delta := b.Value - a.Value
+    if math.Abs(delta) <= tol.Absolute || (a.Value != 0 && math.Abs(delta/a.Value) <= tol.Relative) {
+        return withinTolerance, ""
+    }
+    if a.Value == 0 {
+        return valueChanged, fmt.Sprintf("Δ %+.4g, from zero", delta)
+    }
+    note := fmt.Sprintf("Δ %+.4g, %+.3g%%", delta, 100*delta/math.Abs(a.Value))
+    if ratio := b.Value / a.Value; math.Abs(ratio) >= 10 || (ratio != 0 && math.Abs(ratio) <= 0.1) {
+        note += fmt.Sprintf(", ×%.3g", ratio)
+    }
+    return valueChanged, note
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestParseNumber(t *testing.T) {
+    tests := []struct {
+        in    string
+        ok    bool
+        value float64
+        unit  string
+    }{
+        {"42", true, 42, ""},
+        {"  42  ", true, 42, ""},
+        {"-3.5", true, -3.5, ""},
+        {"+3.5", true, 3.5, ""},
+        {"−7", true, -7, ""},
+        {".5", true, 0.5, ""},
+        {"5.", true, 5, ""},
+        {"9,192,631,770", true, 9192631770, ""},
+        {"1,200.50", true, 1200.5, ""},
+        {"1,20", false, 0, ""},
+        {"1,2345", false, 0, ""},
+        {"6.674e-11", true, 6.674e-11, ""},
+        {"6.674E+11", true, 6.674e11, ""},
+        {"1e5", true, 1e5, ""},
+        {"1e", false, 0, ""},
+        {"12.5%", true, 12.5, "%"},
+        {"12.5 %", true, 12.5, "%"},
+        {"299792458 m/s", true, 299792458, "m/s"},
+        {"5km", true, 5, "km"},
+        {"5 km", true, 5, "km"},
+        {"-40°C", true, -40, "°C"},
+        {"$1,200.50", true, 1200.5, "$"},
+        {"€ 3", true, 3, "€"},
+        {"£2 bn", true, 2, "£ bn"},
+        {"0x10", false, 0, ""},
+        {"0X1F", false, 0, ""},
+        {"3rd", false, 0, ""},
+        {"12/07/2020", false, 0, ""},
+        {"2020-12-07", false, 0, ""},
+        {"1.2.3", false, 0, ""},
+        {"abc", false, 0, ""},
+        {"", false, 0, ""},
+        {"-", false, 0, ""},
+    }
+    for _, tt := range tests {
+        n, ok := parseNumber(tt.in)
+        if ok != tt.ok {
+            t.Errorf("parseNumber(%q) ok = %v, want %v (got %+v)", tt.in, ok, tt.ok, n)
+            continue
+        }
+        if ok && (n.Value != tt.value || n.Unit != tt.unit) {
+            t.Errorf("parseNumber(%q) = %v %q, want %v %q", tt.in, n.Value, n.Unit, tt.value, tt.unit)
+        }
+    }
+}
+
+func TestCompareFields(t *testing.T) {
+    tests := []struct {
+        a, b string
+        tol  ToleranceConfig
+        kind fieldKind
+        note string // prefix of the expected note
+    }{
+        {"1200", "1,200", ToleranceConfig{}, formatOnly, ""},
+        {"1.50", "1.5", ToleranceConfig{}, formatOnly, ""},
+        {"1e3", "1000", ToleranceConfig{}, formatOnly, ""},
+        {"5 km", "5km", ToleranceConfig{}, formatOnly, ""},
+        {"5 km", "5 m", ToleranceConfig{}, valueChanged, "unit 'km' → 'm'"},
+        {"100", "110", ToleranceConfig{}, valueChanged, "Δ +10, +10%"},
+        {"100", "90", ToleranceConfig{}, valueChanged, "Δ -10, -10%"},
+        {"-100", "-90", ToleranceConfig{}, valueChanged, "Δ +10, +10%"},
+        {"100", "1000", ToleranceConfig{}, valueChanged, "Δ +900, +900%, ×10"},
+        {"703.13", "1.0", ToleranceConfig{}, valueChanged, "Δ -702.1, -99.9%, ×0.00142"},
+        {"0", "5", ToleranceConfig{}, valueChanged, "Δ +5, from zero"},
+        {"0", "5", ToleranceConfig{Relative: 1}, valueChanged, "Δ +5, from zero"},
+        {"100", "100.5", ToleranceConfig{Absolute: 0.5}, withinTolerance, ""},
+        {"100", "100.6", ToleranceConfig{Absolute: 0.5}, valueChanged, "Δ +0.6"},
+        {"100", "101", ToleranceConfig{Relative: 0.01}, withinTolerance, ""},
+        {"100", "99", ToleranceConfig{Relative: 0.01}, withinTolerance, ""},
+        {"100", "101.1", ToleranceConfig{Relative: 0.01}, valueChanged, "Δ +1.1"},
+        {"12%", "12.1%", ToleranceConfig{Absolute: 0.1}, withinTolerance, ""},
+        {"0x10", "0x11", ToleranceConfig{Absolute: 10}, valueChanged, ""},
+        {"abc", "abd", ToleranceConfig{Absolute: 10}, valueChanged, ""},
+        {"10", "ten", ToleranceConfig{}, valueChanged, ""},
+    }
+    for _, tt := range tests {
+        kind, note := compareFields(tt.a, tt.b, tt.tol)
+        if kind != tt.kind || !strings.HasPrefix(note, tt.note) || (tt.note == "" && note != "") {
+            t.Errorf("compareFields(%q, %q, %+v) = %v %q, want %v %q", tt.a, tt.b, tt.tol, kind, note, tt.kind, tt.note)
+        }
+    }
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "time"
+)
+
+func writeOutputs(ws *WatchSet, ts string, entries []shiftEntry) *LogHead {
+    var head *LogHead
+    for _, out := range ws.Outputs {
+        if len(entries) == 0 {
+            if out.Type == "file" && head == nil {
+                head = currentLogHead(out.Path)
+            }
+            continue
+        }
+
+        var err error
+        switch out.Type {
+        case "file":
+            var h *LogHead
+            h, err = appendChainedLog(out.Path, ws, entries, out.Sign)
+            if head == nil {
+                head = h
+            }
+        case "stdout":
+            for _, entry := range entries {
+                fmt.Println(entry.Text)
+            }
+        case "webhook":
+            err = postWebhook(out.URL, ws.Name, entries)
+        }
+        if err != nil {
+            fmt.Printf("[%s] Error writing %s output: %v\n", ts, out.Type, err)
+        }
+    }
+    return head
+}
+
+func currentLogHead(path string) *LogHead {
+    data, err := os.ReadFile(logHeadPath(path))
+    if err != nil {
+        return nil
+    }
+    var head LogHead
+    if err := json.Unmarshal(data, &head); err != nil {
+        return nil
+    }
+    return &head
+}
+
+func postWebhook(rawURL, watchSet string, entries []shiftEntry) error {
+    var items []map[string]string
+    for _, entry := range entries {
+        items = append(items, map[string]string{"file": entry.File, "kind": entry.Kind, "text": entry.Text})
+    }
+    payload, err := json.Marshal(map[string]interface{}{
+        "watch_set": watchSet,
+        "entries":   items,
+    })
+    if err != nil {
+        return err
+    }
+
+    client := &http.Client{
+        Timeout: 30 * time.Second,
+    }
+    resp, err := client.Post(rawURL, "application/json", bytes.NewReader(payload))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+    }
+    return nil
+}
+
+func logPaths(ws *WatchSet) []string {
+    var paths []string
+    for _, out := range ws.Outputs {
+        if out.Type == "file" {
+            paths = append(paths, out.Path)
+        }
+    }
+    return paths
+}
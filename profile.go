@@ -0,0 +1,173 @@
+package main
+
+import (
+    "bytes"
+    "compress/flate"
+    "compress/gzip"
+    "compress/zlib"
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+)
+
+// Built-in request profiles, available by name unless a watch set defines a
+// profile with the same name. googlebot is the request the tool has always
+// sent.
+var builtinProfiles = []ProfileConfig{
+    {
+        Name:      "googlebot",
+        UserAgent: "Googlebot/2.1; +http://www.google.com/bot.html",
+        Headers: map[string]string{
+            "Cache-Control":     "no-cache, no-store, must-revalidate",
+            "Pragma":            "no-cache",
+            "Expires":           "0",
+            "If-Modified-Since": "Thu, 01 Jan 1970 00:00:00 GMT",
+            "If-None-Match":     "",
+            "Connection":        "close",
+        },
+    },
+    {
+        Name:      "browser",
+        UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+        Headers: map[string]string{
+            "Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+            "Accept-Language": "en-US,en;q=0.9",
+            "Cache-Control":   "no-cache",
+        },
+        AcceptEncoding: "gzip, deflate",
+    },
+    {
+        Name:      "curl",
+        UserAgent: "curl/8.5.0",
+        Headers: map[string]string{
+            "Accept": "*/*",
+        },
+        AcceptEncoding: "identity",
+    },
+}
+
+func (ws *WatchSet) profile(name string) *ProfileConfig {
+    for i := range ws.Profiles {
+        if ws.Profiles[i].Name == name {
+            return &ws.Profiles[i]
+        }
+    }
+    for i := range builtinProfiles {
+        if builtinProfiles[i].Name == name {
+            return &builtinProfiles[i]
+        }
+    }
+    return nil
+}
+
+func (ws *WatchSet) requestProfile() *ProfileConfig {
+    return ws.profile(ws.Fetch.Profile)
+}
+
+func profileNames(ws *WatchSet) []string {
+    seen := map[string]bool{}
+    var names []string
+    for _, p := range append(append([]ProfileConfig{}, ws.Profiles...), builtinProfiles...) {
+        if !seen[p.Name] {
+            seen[p.Name] = true
+            names = append(names, p.Name)
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+// apply sets the profile's headers on req. Without an explicit
+// accept_encoding the transport negotiates gzip and decodes it itself.
+func (p *ProfileConfig) apply(req *http.Request) {
+    for k, v := range p.Headers {
+        req.Header.Set(k, v)
+    }
+    if p.UserAgent != "" {
+        req.Header.Set("User-Agent", p.UserAgent)
+    }
+    if p.AcceptEncoding != "" {
+        req.Header.Set("Accept-Encoding", p.AcceptEncoding)
+    } else {
+        req.Header.Del("Accept-Encoding")
+    }
+}
+
+// decodeBody undoes a Content-Encoding the transport left alone because the
+// profile asked for it explicitly.
+func decodeBody(encoding string, body []byte) ([]byte, error) {
+    var r io.Reader
+    switch strings.ToLower(strings.TrimSpace(encoding)) {
+    case "", "identity":
+        return body, nil
+    case "gzip", "x-gzip":
+        zr, err := gzip.NewReader(bytes.NewReader(body))
+        if err != nil {
+            return nil, err
+        }
+        r = zr
+    case "deflate":
+        // Servers disagree on whether deflate means zlib-wrapped or raw.
+        if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+            r = zr
+        } else {
+            r = flate.NewReader(bytes.NewReader(body))
+        }
+    default:
+        return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+    }
+    return io.ReadAll(r)
+}
+
+type CloakingFile struct {
+    Name     string            `json:"name"`
+    Profiles map[string]string `json:"profiles"`
+}
+
+// runCloakingCheck fetches names again under each configured cloaking profile
+// and reports files whose content or availability depends on the profile.
+func runCloakingCheck(ctx context.Context, ws *WatchSet, names []string, primaryOutcomes []fetchOutcome, store *objectStore, ts string) ([]CloakingFile, []shiftEntry) {
+    views := []*sourceView{{name: ws.Fetch.Profile, source: ws.source(), outcomes: primaryOutcomes}}
+    for _, name := range ws.Cloaking.Profiles {
+        if name == ws.Fetch.Profile {
+            continue
+        }
+        views = append(views, &sourceView{name: name, source: newSource(ws, ws.Source, ws.profile(name))})
+    }
+    fetchViews(ctx, ws, names, views)
+
+    var report []CloakingFile
+    var alerts []shiftEntry
+    for i, name := range names {
+        served := map[string]string{}
+        distinct := map[string]bool{}
+        for _, v := range views {
+            hash, _, failure := outcomeHash(store, v.outcomes[i])
+            if hash == "" {
+                hash = failure
+            }
+            served[v.name] = hash
+            distinct[hash] = true
+        }
+        if len(distinct) < 2 {
+            continue
+        }
+        report = append(report, CloakingFile{Name: name, Profiles: served})
+
+        var parts []string
+        for _, v := range views {
+            s := served[v.name]
+            if len(s) == 64 {
+                s = s[:12]
+            }
+            parts = append(parts, v.name+"="+s)
+        }
+        fmt.Printf("[%s] %s: CLOAKING DETECTED! Content depends on request profile\n", ts, name)
+        text := fmt.Sprintf("[%s] %s: Server returns different content per request profile: %s\n", ts, name, strings.Join(parts, ", "))
+        alerts = append(alerts, shiftEntry{File: name, Kind: "cloaking", Text: text})
+    }
+    return report, alerts
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+)
+
+const primaryMirror = "primary"
+
+type QuorumReport struct {
+    Mirrors []MirrorRoot `json:"mirrors"`
+    Files   []QuorumFile `json:"files"`
+}
+
+type MirrorRoot struct {
+    Name   string `json:"name"`
+    Source string `json:"source"`
+    Root   string `json:"root"`
+    Failed int    `json:"failed,omitempty"`
+}
+
+// Disagree maps each mirror that did not serve the majority content to the
+// hash it served, or to why it served nothing.
+type QuorumFile struct {
+    Name     string            `json:"name"`
+    Majority string            `json:"majority,omitempty"`
+    Votes    int               `json:"votes"`
+    Voters   int               `json:"voters"`
+    Disagree map[string]string `json:"disagree,omitempty"`
+}
+
+// A sourceView is one way of asking for the watch set's files: a mirror, or
+// the primary source under a different request profile.
+type sourceView struct {
+    name     string
+    source   Source
+    outcomes []fetchOutcome
+}
+
+// fetchViews fetches names for every view that has no outcomes yet, all
+// views at once through one pipeline so the concurrency cap and per-host
+// limits are shared.
+func fetchViews(ctx context.Context, ws *WatchSet, names []string, views []*sourceView) {
+    var wg sync.WaitGroup
+    for _, v := range views {
+        gs, ok := v.source.(*gitSource)
+        if v.outcomes != nil || !ok {
+            continue
+        }
+        wg.Add(1)
+        go func(v *sourceView, gs *gitSource) {
+            defer wg.Done()
+            if err := gs.pin(ctx); err != nil {
+                v.outcomes = make([]fetchOutcome, len(names))
+                for i := range v.outcomes {
+                    v.outcomes[i].Err = err
+                }
+            }
+        }(v, gs)
+    }
+    wg.Wait()
+
+    var pending []*sourceView
+    var jobs []fetchJob
+    for _, v := range views {
+        if v.outcomes != nil {
+            continue
+        }
+        pending = append(pending, v)
+        for _, name := range names {
+            jobs = append(jobs, fetchJob{name: name, host: v.source.Host(), fetch: v.source.Fetch})
+        }
+    }
+    outcomes := newFetchPipeline(ws.Fetch).runJobs(ctx, jobs)
+    for i, v := range pending {
+        v.outcomes = outcomes[i*len(names) : (i+1)*len(names)]
+    }
+}
+
+// outcomeHash stores a fetched body and returns its hash, or the failure
+// status and a description when there is no body.
+func outcomeHash(store *objectStore, o fetchOutcome) (string, string, string) {
+    if o.Err != nil {
+        status := fetchStatus(o.Err)
+        return "", status, status + ": " + o.Err.Error()
+    }
+    if o.Remote.StatusCode != http.StatusOK {
+        return "", "http-error", fmt.Sprintf("HTTP %d", o.Remote.StatusCode)
+    }
+    hash, err := store.put(o.Remote.Body)
+    if err != nil {
+        hash = sha256Hex(o.Remote.Body)
+    }
+    return hash, "", ""
+}
+
+// runQuorum fetches names from every configured mirror and compares what each
+// served with the primary source's outcomes. The primary counts as one voter;
+// a file has a majority when more than half of all voters served the same
+// content.
+func runQuorum(ctx context.Context, ws *WatchSet, names []string, primary Source, primaryOutcomes []fetchOutcome, store *objectStore, ts string) (*QuorumReport, []shiftEntry) {
+    fetches := []*sourceView{{name: primaryMirror, source: primary, outcomes: primaryOutcomes}}
+    for _, m := range ws.Mirrors {
+        fetches = append(fetches, &sourceView{name: m.Name, source: newSource(ws, m.SourceConfig, ws.requestProfile())})
+    }
+    fetchViews(ctx, ws, names, fetches)
+
+    hashes := make([][]string, len(fetches))
+    failures := make([][]string, len(fetches))
+    var status string
+    report := &QuorumReport{}
+    for m, f := range fetches {
+        hashes[m] = make([]string, len(names))
+        failures[m] = make([]string, len(names))
+        var leaves []merkleLeaf
+        failed := 0
+        for i, name := range names {
+            hashes[m][i], status, failures[m][i] = outcomeHash(store, f.outcomes[i])
+            leaf := merkleLeaf{Name: name, Hash: hashes[m][i]}
+            if leaf.Hash == "" {
+                leaf.Hash = statusLeafHash(status)
+                failed++
+            }
+            leaves = append(leaves, leaf)
+        }
+        root, err := merkleRoot(leaves)
+        if err != nil {
+            fmt.Printf("[%s] %s: Error computing Merkle root: %v\n", ts, f.name, err)
+        }
+        report.Mirrors = append(report.Mirrors, MirrorRoot{Name: f.name, Source: f.source.String(), Root: root, Failed: failed})
+        fmt.Printf("[%s] Mirror %s (%s): Merkle root 0x%s, %d of %d files failed\n", ts, f.name, f.source, root, failed, len(names))
+    }
+
+    var splits []shiftEntry
+    for i, name := range names {
+        votes := map[string]int{}
+        for m := range fetches {
+            if hashes[m][i] != "" {
+                votes[hashes[m][i]]++
+            }
+        }
+        qf := QuorumFile{Name: name, Voters: len(fetches)}
+        for hash, n := range votes {
+            if n > qf.Votes || n == qf.Votes && hash < qf.Majority {
+                qf.Majority, qf.Votes = hash, n
+            }
+        }
+        if qf.Votes*2 <= qf.Voters {
+            qf.Majority = ""
+        }
+
+        var dissent []string
+        for m, f := range fetches {
+            if hashes[m][i] != "" && hashes[m][i] == qf.Majority {
+                continue
+            }
+            if qf.Disagree == nil {
+                qf.Disagree = map[string]string{}
+            }
+            served := hashes[m][i]
+            if served == "" {
+                served = failures[m][i]
+            }
+            qf.Disagree[f.name] = served
+            if len(served) == 64 {
+                served = served[:12]
+            }
+            dissent = append(dissent, f.name+"="+served)
+        }
+        report.Files = append(report.Files, qf)
+        if len(dissent) == 0 {
+            continue
+        }
+
+        sort.Strings(dissent)
+        verdict := fmt.Sprintf("no majority among %d mirrors", qf.Voters)
+        if qf.Majority != "" {
+            verdict = fmt.Sprintf("majority sha256 %s (%d of %d mirrors)", qf.Majority, qf.Votes, qf.Voters)
+        }
+        fmt.Printf("[%s] %s: SPLIT VIEW DETECTED! Mirrors disagree, %s\n", ts, name, verdict)
+        text := fmt.Sprintf("[%s] %s: Mirrors disagree - %s; differing: %s\n", ts, name, verdict, strings.Join(dissent, ", "))
+        splits = append(splits, shiftEntry{File: name, Kind: "split", Text: text})
+    }
+    return report, splits
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+    "bytes"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+const receiptVersion = 2
+
+type fileResult struct {
+    Name   string `json:"name"`
+    Hash   string `json:"hash"`
+    Status string `json:"status"`
+    Local  string `json:"local,omitempty"`
+    Detail string `json:"detail,omitempty"`
+}
+
+type Receipt struct {
+    Version     int            `json:"version"`
+    WatchSet    string         `json:"watch_set"`
+    Remote      string         `json:"remote"`
+    Commit      string         `json:"commit,omitempty"`
+    StartedAt   time.Time      `json:"started_at"`
+    CompletedAt time.Time      `json:"completed_at"`
+    Root        string         `json:"root"`
+    Files       []fileResult   `json:"files"`
+    LogHead     *LogHead       `json:"log_head,omitempty"`
+    Quorum      *QuorumReport  `json:"quorum,omitempty"`
+    Cloaking    []CloakingFile `json:"cloaking,omitempty"`
+}
+
+// The signature covers the compact JSON encoding of the receipt object, so
+// receipts can be pretty-printed on disk and still verify.
+type SignedReceipt struct {
+    Receipt   json.RawMessage `json:"receipt"`
+    PublicKey string          `json:"public_key"`
+    Signature string          `json:"signature"`
+}
+
+// Version 1 receipts used zeroHash for every file without content; since
+// version 2 such leaves commit to the failure status instead.
+func resultLeaves(version int, results []fileResult) []merkleLeaf {
+    leaves := make([]merkleLeaf, len(results))
+    for i, r := range results {
+        leaves[i] = merkleLeaf{Name: r.Name, Hash: r.Hash}
+        if version >= 2 && r.Hash == zeroHash {
+            leaves[i].Hash = statusLeafHash(r.Status)
+        }
+    }
+    return leaves
+}
+
+func generateKeyPair(privPath, pubPath string) error {
+    pub, priv, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        return err
+    }
+
+    privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+    if err != nil {
+        return err
+    }
+    pubDER, err := x509.MarshalPKIXPublicKey(pub)
+    if err != nil {
+        return err
+    }
+
+    if err := os.MkdirAll(filepath.Dir(privPath), 0700); err != nil {
+        return err
+    }
+    privFile, err := os.OpenFile(privPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return err
+    }
+    defer privFile.Close()
+    if err := pem.Encode(privFile, &pem.Block{Type: "PRIVATE KEY", Bytes: privDER}); err != nil {
+        return err
+    }
+
+    return os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644)
+}
+
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    block, _ := pem.Decode(data)
+    if block == nil || block.Type != "PRIVATE KEY" {
+        return nil, fmt.Errorf("%s: not a PEM private key", path)
+    }
+    key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    priv, ok := key.(ed25519.PrivateKey)
+    if !ok {
+        return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+    }
+    return priv, nil
+}
+
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    block, _ := pem.Decode(data)
+    if block == nil || block.Type != "PUBLIC KEY" {
+        return nil, fmt.Errorf("%s: not a PEM public key", path)
+    }
+    key, err := x509.ParsePKIXPublicKey(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    pub, ok := key.(ed25519.PublicKey)
+    if !ok {
+        return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+    }
+    return pub, nil
+}
+
+func signReceipt(receipt *Receipt, priv ed25519.PrivateKey) (*SignedReceipt, error) {
+    payload, err := json.Marshal(receipt)
+    if err != nil {
+        return nil, err
+    }
+    return &SignedReceipt{
+        Receipt:   payload,
+        PublicKey: base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)),
+        Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload)),
+    }, nil
+}
+
+func writeReceipt(ws *WatchSet, receipt *Receipt) (string, error) {
+    priv, err := loadPrivateKey(ws.SigningKey)
+    if err != nil {
+        return "", err
+    }
+    signed, err := signReceipt(receipt, priv)
+    if err != nil {
+        return "", err
+    }
+    data, err := json.MarshalIndent(signed, "", "  ")
+    if err != nil {
+        return "", err
+    }
+
+    path := filepath.Join(ws.StateDir, "receipts", receipt.CompletedAt.Format("20060102T150405.000000000Z")+".json")
+    return path, writeFileAtomic(path, append(data, '\n'))
+}
+
+func verifyReceipt(data []byte, pub ed25519.PublicKey) (*Receipt, error) {
+    var signed SignedReceipt
+    if err := json.Unmarshal(data, &signed); err != nil {
+        return nil, fmt.Errorf("not a signed receipt: %v", err)
+    }
+
+    sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+    if err != nil {
+        return nil, fmt.Errorf("bad signature encoding: %v", err)
+    }
+    if embedded, err := base64.StdEncoding.DecodeString(signed.PublicKey); err == nil && !pub.Equal(ed25519.PublicKey(embedded)) {
+        return nil, errors.New("receipt was signed by a different key")
+    }
+    var payload bytes.Buffer
+    if err := json.Compact(&payload, signed.Receipt); err != nil {
+        return nil, fmt.Errorf("bad receipt payload: %v", err)
+    }
+    if !ed25519.Verify(pub, payload.Bytes(), sig) {
+        return nil, errors.New("signature does not verify")
+    }
+
+    var receipt Receipt
+    if err := json.Unmarshal(signed.Receipt, &receipt); err != nil {
+        return nil, fmt.Errorf("signed payload is not a receipt: %v", err)
+    }
+    root, err := merkleRoot(resultLeaves(receipt.Version, receipt.Files))
+    if err != nil {
+        return nil, err
+    }
+    if root != receipt.Root {
+        return nil, fmt.Errorf("file list hashes to root %s, receipt claims %s", root, receipt.Root)
+    }
+    return &receipt, nil
+}
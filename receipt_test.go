@@ -0,0 +1,138 @@
+package main
+
+import (
+    "crypto/ed25519"
+    "encoding/base64"
+    "encoding/json"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func testKeys(t *testing.T) (ed25519.PrivateKey, ed25519.PublicKey) {
+    t.Helper()
+    dir := t.TempDir()
+    privPath, pubPath := filepath.Join(dir, "receipt.key"), filepath.Join(dir, "receipt.pub")
+    if err := generateKeyPair(privPath, pubPath); err != nil {
+        t.Fatal(err)
+    }
+    priv, err := loadPrivateKey(privPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pub, err := loadPublicKey(pubPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return priv, pub
+}
+
+func testReceipt(t *testing.T) *Receipt {
+    t.Helper()
+    files := []fileResult{
+        {Name: "bitcoin.csv", Hash: sha256Hex([]byte("bitcoin")), Status: "ok", Local: "ok"},
+        {Name: "stars.csv", Hash: zeroHash, Status: "timeout", Local: "ok"},
+        {Name: "time.csv", Hash: sha256Hex([]byte("time")), Status: "changed", Local: "ok"},
+    }
+    root, err := merkleRoot(resultLeaves(receiptVersion, files))
+    if err != nil {
+        t.Fatal(err)
+    }
+    started := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+    return &Receipt{
+        Version:     receiptVersion,
+        WatchSet:    "default",
+        Remote:      "https://example.org/data/",
+        StartedAt:   started,
+        CompletedAt: started.Add(42 * time.Second),
+        Root:        root,
+        Files:       files,
+    }
+}
+
+// signedJSON signs receipt and encodes it the way writeReceipt does.
+func signedJSON(t *testing.T, receipt *Receipt, priv ed25519.PrivateKey) []byte {
+    t.Helper()
+    signed, err := signReceipt(receipt, priv)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, err := json.MarshalIndent(signed, "", "  ")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return data
+}
+
+// editPayload rewrites one field of the signed receipt without re-signing it.
+func editPayload(t *testing.T, data []byte, field string, value interface{}) []byte {
+    t.Helper()
+    var signed SignedReceipt
+    if err := json.Unmarshal(data, &signed); err != nil {
+        t.Fatal(err)
+    }
+    var payload map[string]interface{}
+    if err := json.Unmarshal(signed.Receipt, &payload); err != nil {
+        t.Fatal(err)
+    }
+    payload[field] = value
+    raw, err := json.Marshal(payload)
+    if err != nil {
+        t.Fatal(err)
+    }
+    signed.Receipt = raw
+    out, err := json.Marshal(signed)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return out
+}
+
+func TestVerifyReceipt(t *testing.T) {
+    priv, pub := testKeys(t)
+    otherPriv, otherPub := testKeys(t)
+    receipt := testReceipt(t)
+    data := signedJSON(t, receipt, priv)
+
+    got, err := verifyReceipt(data, pub)
+    if err != nil {
+        t.Fatalf("valid receipt: %v", err)
+    }
+    if got.Root != receipt.Root || !got.CompletedAt.Equal(receipt.CompletedAt) || len(got.Files) != len(receipt.Files) {
+        t.Errorf("verified receipt %+v, want %+v", got, receipt)
+    }
+
+    badRoot := *receipt
+    badRoot.Root = sha256Hex([]byte("another root"))
+    swappedKey := func() []byte {
+        var signed SignedReceipt
+        if err := json.Unmarshal(data, &signed); err != nil {
+            t.Fatal(err)
+        }
+        signed.PublicKey = base64.StdEncoding.EncodeToString(otherPub)
+        out, err := json.Marshal(signed)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return out
+    }()
+
+    tests := []struct {
+        name string
+        data []byte
+        pub  ed25519.PublicKey
+    }{
+        {"root changed", editPayload(t, data, "root", badRoot.Root), pub},
+        {"completion time changed", editPayload(t, data, "completed_at", receipt.CompletedAt.Add(time.Hour)), pub},
+        {"start time changed", editPayload(t, data, "started_at", receipt.StartedAt.Add(-time.Hour)), pub},
+        {"verified with another key", data, otherPub},
+        {"embedded key swapped", swappedKey, otherPub},
+        {"signed by another key", signedJSON(t, receipt, otherPriv), pub},
+        {"signed root does not match files", signedJSON(t, &badRoot, priv), pub},
+    }
+    for _, tt := range tests {
+        if _, err := verifyReceipt(tt.data, tt.pub); err == nil {
+            t.Errorf("%s: receipt verified", tt.name)
+        }
+    }
+}
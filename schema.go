@@ -0,0 +1,273 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+const schemaFile = "schemas.json"
+
+// tableSchema is the shape of one version of a CSV file, inferred from its
+// header and values. Object is the content hash it was inferred from.
+type tableSchema struct {
+    Object     string         `json:"object"`
+    Columns    []columnSchema `json:"columns"`
+    Rows       int            `json:"rows"`
+    InferredAt time.Time      `json:"inferred_at"`
+}
+
+type columnSchema struct {
+    Name       string `json:"name"`
+    Type       string `json:"type"`
+    Nullable   bool   `json:"nullable,omitempty"`
+    DateFormat string `json:"date_format,omitempty"`
+}
+
+func (c columnSchema) describe() string {
+    if c.DateFormat != "" {
+        return c.Type + " " + c.DateFormat
+    }
+    return c.Type
+}
+
+var dateLayouts = []struct{ layout, label string }{
+    {"2006-01-02", "YYYY-MM-DD"},
+    {"2006/01/02", "YYYY/MM/DD"},
+    {"01/02/2006", "MM/DD/YYYY"},
+    {"02/01/2006", "DD/MM/YYYY"},
+    {"02.01.2006", "DD.MM.YYYY"},
+    {"Jan 2, 2006", "Mon D, YYYY"},
+    {"2 Jan 2006", "D Mon YYYY"},
+    {"2006-01-02 15:04:05", "YYYY-MM-DD hh:mm:ss"},
+    {time.RFC3339, "RFC 3339"},
+}
+
+var nullValues = map[string]bool{"": true, "na": true, "n/a": true, "none": true, "null": true, "nan": true, "-": true}
+
+type schemaStore struct {
+    files map[string]*tableSchema
+}
+
+func schemaPath(ws *WatchSet) string {
+    return filepath.Join(ws.StateDir, schemaFile)
+}
+
+func loadSchemas(ws *WatchSet) (*schemaStore, error) {
+    s := &schemaStore{files: map[string]*tableSchema{}}
+    data, err := os.ReadFile(schemaPath(ws))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return s, nil
+        }
+        return nil, err
+    }
+    if err := json.Unmarshal(data, &s.files); err != nil {
+        return nil, fmt.Errorf("%s: %v", schemaPath(ws), err)
+    }
+    return s, nil
+}
+
+func (s *schemaStore) save(ws *WatchSet) error {
+    data, err := json.MarshalIndent(s.files, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(schemaPath(ws), append(data, '\n'))
+}
+
+// record infers and keeps the schema of the baseline version of filename.
+func (s *schemaStore) record(ws *WatchSet, filename, object string, data []byte) (*tableSchema, error) {
+    schema, err := inferSchema(&ws.Diff.CSV, filename, data)
+    if err != nil {
+        return nil, err
+    }
+    schema.Object = object
+    s.files[filename] = schema
+    return schema, nil
+}
+
+// drift compares a remote version with the baseline schema, re-inferring
+// the baseline from localData when the stored schema is missing or belongs
+// to an older baseline (after an accept).
+func (s *schemaStore) drift(ws *WatchSet, filename, baselineHash string, localData, remoteData []byte) []string {
+    base := s.files[filename]
+    if base == nil || base.Object != baselineHash {
+        var err error
+        if base, err = s.record(ws, filename, baselineHash, localData); err != nil {
+            return nil
+        }
+    }
+    remote, err := inferSchema(&ws.Diff.CSV, filename, remoteData)
+    if err != nil {
+        return []string{fmt.Sprintf("Remote no longer parses as a table: %v", err)}
+    }
+    return compareSchemas(base, remote)
+}
+
+// inferSchema reads CSV leniently whatever the parse mode: ragged rows are
+// reported as structure findings and should not stop the schema from being
+// inferred.
+func inferSchema(opts *CSVDiffConfig, filename string, data []byte) (*tableSchema, error) {
+    var rows [][]string
+    if t := opts.table(filename); t != nil && t.Format == "fixed" {
+        fixed, err := parseFixedWidth(data, t.Columns)
+        if err != nil {
+            return nil, err
+        }
+        rows = fixed.Rows
+    } else {
+        rows = parseLenientCSV(data).Rows
+    }
+    schema := &tableSchema{InferredAt: time.Now().UTC()}
+    if len(rows) == 0 {
+        return schema, nil
+    }
+    schema.Rows = len(rows) - 1
+    for i, name := range rows[0] {
+        values := make([]string, 0, len(rows)-1)
+        for _, row := range rows[1:] {
+            values = append(values, strings.TrimSpace(field(row, i)))
+        }
+        schema.Columns = append(schema.Columns, inferColumn(strings.TrimSpace(name), values))
+    }
+    return schema, nil
+}
+
+// inferColumn picks the narrowest type every non-null value fits: integer,
+// number, quantity (a number with a unit), boolean, date or else text.
+// Integers mixed with decimals make a number column.
+func inferColumn(name string, values []string) columnSchema {
+    c := columnSchema{Name: name}
+    kinds := map[string]bool{}
+    var present []string
+    for _, v := range values {
+        if nullValues[strings.ToLower(v)] {
+            c.Nullable = true
+            continue
+        }
+        present = append(present, v)
+        kinds[valueKind(v)] = true
+    }
+
+    switch {
+    case len(present) == 0:
+        c.Type = "empty"
+    case len(kinds) == 1:
+        for k := range kinds {
+            c.Type = k
+        }
+    case len(kinds) == 2 && kinds["integer"] && kinds["number"]:
+        c.Type = "number"
+    default:
+        c.Type = "text"
+    }
+
+    if c.Type == "date" {
+        c.DateFormat = "mixed"
+        for _, l := range dateLayouts {
+            if allParse(l.layout, present) {
+                c.DateFormat = l.label
+                break
+            }
+        }
+    }
+    return c
+}
+
+func valueKind(v string) string {
+    switch strings.ToLower(v) {
+    case "true", "false", "yes", "no":
+        return "boolean"
+    }
+    if n, ok := parseNumber(v); ok {
+        if n.Unit != "" {
+            return "quantity"
+        }
+        if strings.ContainsAny(v, ".eE") {
+            return "number"
+        }
+        return "integer"
+    }
+    for _, l := range dateLayouts {
+        if _, err := time.Parse(l.layout, v); err == nil {
+            return "date"
+        }
+    }
+    return "text"
+}
+
+func allParse(layout string, values []string) bool {
+    for _, v := range values {
+        if _, err := time.Parse(layout, v); err != nil {
+            return false
+        }
+    }
+    return true
+}
+
+// compareSchemas reports columns added, removed, retyped or reordered,
+// matching columns by header name.
+func compareSchemas(base, remote *tableSchema) []string {
+    var out []string
+    if len(base.Columns) != len(remote.Columns) {
+        out = append(out, fmt.Sprintf("Column count: %d → %d", len(base.Columns), len(remote.Columns)))
+    }
+    baseIndex := columnIndex(base.Columns)
+    remoteIndex := columnIndex(remote.Columns)
+
+    for _, c := range base.Columns {
+        if _, ok := remoteIndex[c.Name]; !ok {
+            out = append(out, fmt.Sprintf("Column removed: '%s' (%s)", c.Name, c.describe()))
+        }
+    }
+    for _, c := range remote.Columns {
+        if _, ok := baseIndex[c.Name]; !ok {
+            out = append(out, fmt.Sprintf("Column added: '%s' (%s)", c.Name, c.describe()))
+        }
+    }
+
+    var baseOrder, remoteOrder []string
+    for _, c := range base.Columns {
+        j, ok := remoteIndex[c.Name]
+        if !ok {
+            continue
+        }
+        baseOrder = append(baseOrder, c.Name)
+        r := remote.Columns[j]
+        if c.Type != r.Type {
+            out = append(out, fmt.Sprintf("Column '%s' retyped: %s → %s", c.Name, c.describe(), r.describe()))
+        } else if c.DateFormat != r.DateFormat {
+            out = append(out, fmt.Sprintf("Column '%s' date format: %s → %s", c.Name, c.DateFormat, r.DateFormat))
+        }
+        if c.Nullable != r.Nullable {
+            if r.Nullable {
+                out = append(out, fmt.Sprintf("Column '%s' now has empty values", c.Name))
+            } else {
+                out = append(out, fmt.Sprintf("Column '%s' no longer has empty values", c.Name))
+            }
+        }
+    }
+    for _, c := range remote.Columns {
+        if _, ok := baseIndex[c.Name]; ok {
+            remoteOrder = append(remoteOrder, c.Name)
+        }
+    }
+    if strings.Join(baseOrder, "\x00") != strings.Join(remoteOrder, "\x00") {
+        out = append(out, fmt.Sprintf("Columns reordered: %s → %s", strings.Join(baseOrder, ","), strings.Join(remoteOrder, ",")))
+    }
+    return out
+}
+
+func columnIndex(columns []columnSchema) map[string]int {
+    index := make(map[string]int, len(columns))
+    for i, c := range columns {
+        if _, ok := index[c.Name]; !ok {
+            index[c.Name] = i
+        }
+    }
+    return index
+}
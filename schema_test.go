@@ -0,0 +1,88 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestInferColumn(t *testing.T) {
+    tests := []struct {
+        name   string
+        values []string
+        want   columnSchema
+    }{
+        {"integers", []string{"1", "-2", "3,000"}, columnSchema{Type: "integer"}},
+        {"integers widen to number", []string{"1", "2.5", "3"}, columnSchema{Type: "number"}},
+        {"exponent is a number", []string{"1", "6.674e-11"}, columnSchema{Type: "number"}},
+        {"numbers widen to text", []string{"1", "2.5", "n/a yet"}, columnSchema{Type: "text"}},
+        {"integers and text", []string{"1", "abc"}, columnSchema{Type: "text"}},
+        {"quantities", []string{"5 km", "12%"}, columnSchema{Type: "quantity"}},
+        {"quantity and number", []string{"5 km", "5"}, columnSchema{Type: "text"}},
+        {"hex is text", []string{"0x10", "0x11"}, columnSchema{Type: "text"}},
+        {"booleans", []string{"true", "No", "YES"}, columnSchema{Type: "boolean"}},
+        {"dates", []string{"2020-12-07", "2021-01-31"}, columnSchema{Type: "date", DateFormat: "YYYY-MM-DD"}},
+        {"day-first dates", []string{"31/12/2020", "01/02/2021"}, columnSchema{Type: "date", DateFormat: "DD/MM/YYYY"}},
+        {"mixed date formats", []string{"2020-12-07", "Dec 7, 2020"}, columnSchema{Type: "date", DateFormat: "mixed"}},
+        {"nullable integers", []string{"1", "", "NA", "null", "-", "2"}, columnSchema{Type: "integer", Nullable: true}},
+        {"nullable text", []string{"a", "None"}, columnSchema{Type: "text", Nullable: true}},
+        {"only nulls", []string{"", "NaN"}, columnSchema{Type: "empty", Nullable: true}},
+        {"no values", nil, columnSchema{Type: "empty"}},
+    }
+    for _, tt := range tests {
+        got := inferColumn("c", tt.values)
+        tt.want.Name = "c"
+        if got != tt.want {
+            t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestInferSchemaRagged(t *testing.T) {
+    // Strict parsing would reject this file; inference reads it leniently.
+    data := []byte("Name,Year,Note\nHubble,1929,expansion\nPenzias,1965,CMB, at 4080 MHz\nPlanck\n")
+    opts := &CSVDiffConfig{Parse: "strict"}
+    schema, err := inferSchema(opts, "cosmos.csv", data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []columnSchema{
+        {Name: "Name", Type: "text"},
+        {Name: "Year", Type: "integer", Nullable: true},
+        {Name: "Note", Type: "text", Nullable: true},
+    }
+    if schema.Rows != 3 || !reflect.DeepEqual(schema.Columns, want) {
+        t.Errorf("schema %d rows %+v, want 3 rows %+v", schema.Rows, schema.Columns, want)
+    }
+}
+
+func TestCompareSchemas(t *testing.T) {
+    opts := &CSVDiffConfig{Parse: "strict"}
+    infer := func(data string) *tableSchema {
+        schema, err := inferSchema(opts, "t.csv", []byte(data))
+        if err != nil {
+            t.Fatal(err)
+        }
+        return schema
+    }
+    base := infer("ID,Value,Date\n1,10,2020-12-07\n2,20,2020-12-08\n")
+    tests := []struct {
+        name   string
+        remote string
+        want   []string
+    }{
+        {"same", "ID,Value,Date\n3,30,2020-12-09\n", nil},
+        {"integer to number", "ID,Value,Date\n1,10.5,2020-12-07\n", []string{"Column 'Value' retyped: integer → number"}},
+        {"number to text", "ID,Value,Date\n1,ten,2020-12-07\n", []string{"Column 'Value' retyped: integer → text"}},
+        {"now nullable", "ID,Value,Date\n1,,2020-12-07\n2,20,2020-12-08\n", []string{"Column 'Value' now has empty values"}},
+        {"date format", "ID,Value,Date\n1,10,07/12/2020\n2,20,31/12/2020\n", []string{"Column 'Date' date format: YYYY-MM-DD → DD/MM/YYYY"}},
+        {"column added", "ID,Value,Date,Extra\n1,10,2020-12-07,x\n", []string{"Column count: 3 → 4", "Column added: 'Extra' (text)"}},
+        {"column removed and reordered", "Date,ID\n2020-12-07,1\n", []string{"Column count: 3 → 2", "Column removed: 'Value' (integer)", "Columns reordered: ID,Date → Date,ID"}},
+    }
+    for _, tt := range tests {
+        got := compareSchemas(base, infer(tt.remote))
+        if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+            t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+    "time"
+)
+
+const maxListedDates = 10
+
+// seriesSide is one version of a time series: the date of every data row
+// (zero when it does not parse) and the numeric values by column.
+type seriesSide struct {
+    dates  []time.Time
+    byDate map[time.Time]int
+}
+
+func readSeries(rows [][]string, col int) seriesSide {
+    values := make([]string, 0, len(rows))
+    for _, row := range rows {
+        values = append(values, strings.TrimSpace(field(row, col)))
+    }
+    layouts := []string{}
+    for _, l := range dateLayouts {
+        if allParse(l.layout, values) {
+            layouts = []string{l.layout}
+            break
+        }
+        layouts = append(layouts, l.layout)
+    }
+
+    s := seriesSide{dates: make([]time.Time, len(values)), byDate: map[time.Time]int{}}
+    for i, v := range values {
+        for _, layout := range layouts {
+            if t, err := time.Parse(layout, v); err == nil {
+                s.dates[i] = t
+                if _, ok := s.byDate[t]; !ok {
+                    s.byDate[t] = i
+                }
+                break
+            }
+        }
+    }
+    return s
+}
+
+// span returns the first and last date and the dates that occur more than
+// once, in order.
+func (s seriesSide) span() (first, last time.Time, dups []time.Time) {
+    count := map[time.Time]int{}
+    for _, t := range s.dates {
+        if t.IsZero() {
+            continue
+        }
+        if first.IsZero() || t.Before(first) {
+            first = t
+        }
+        if t.After(last) {
+            last = t
+        }
+        if count[t]++; count[t] == 2 {
+            dups = append(dups, t)
+        }
+    }
+    sort.Slice(dups, func(i, j int) bool { return dups[i].Before(dups[j]) })
+    return first, last, dups
+}
+
+// missing infers the series step as the most common gap between consecutive
+// dates and returns the dates that would fill larger gaps.
+func (s seriesSide) missing() []time.Time {
+    unique := make([]time.Time, 0, len(s.byDate))
+    for t := range s.byDate {
+        unique = append(unique, t)
+    }
+    sort.Slice(unique, func(i, j int) bool { return unique[i].Before(unique[j]) })
+    if len(unique) < 3 {
+        return nil
+    }
+    gaps := map[time.Duration]int{}
+    var step time.Duration
+    for i := 1; i < len(unique); i++ {
+        g := unique[i].Sub(unique[i-1])
+        if gaps[g]++; gaps[g] > gaps[step] {
+            step = g
+        }
+    }
+
+    var out []time.Time
+    for i := 1; i < len(unique); i++ {
+        g := unique[i].Sub(unique[i-1])
+        if float64(g) < 1.5*float64(step) {
+            continue
+        }
+        n := int(math.Round(float64(g)/float64(step))) - 1
+        for k := 1; k <= n; k++ {
+            out = append(out, unique[i-1].Add(time.Duration(k)*step))
+        }
+    }
+    return out
+}
+
+type columnStats struct {
+    count         int
+    min, max, sum float64
+}
+
+func (c columnStats) mean() float64 {
+    return c.sum / float64(c.count)
+}
+
+func statsOf(rows [][]string, col int, include func(i int) bool) columnStats {
+    var c columnStats
+    for i, row := range rows {
+        if include != nil && !include(i) {
+            continue
+        }
+        n, ok := parseNumber(field(row, col))
+        if !ok {
+            continue
+        }
+        if c.count == 0 || n.Value < c.min {
+            c.min = n.Value
+        }
+        if c.count == 0 || n.Value > c.max {
+            c.max = n.Value
+        }
+        c.sum += n.Value
+        c.count++
+    }
+    return c
+}
+
+// seriesSummary describes how a time series changed as a whole: row count,
+// the date range covered, missing and duplicated dates, and for every
+// numeric column the min, max, mean and sum before and after. The last
+// lines compare only the dates both versions have, which is where edits to
+// history show up even when many new rows were appended.
+func seriesSummary(localCSV, remoteCSV [][]string, column string) ([]string, error) {
+    if len(localCSV) == 0 || len(remoteCSV) == 0 {
+        return nil, fmt.Errorf("missing header row")
+    }
+    localCol, remoteCol := headerIndex(localCSV[0], column), headerIndex(remoteCSV[0], column)
+    if localCol < 0 || remoteCol < 0 {
+        return nil, fmt.Errorf("no %q column", column)
+    }
+    localRows, remoteRows := localCSV[1:], remoteCSV[1:]
+    local, remote := readSeries(localRows, localCol), readSeries(remoteRows, remoteCol)
+
+    out := []string{fmt.Sprintf("Rows: %d → %d (%+d)", len(localRows), len(remoteRows), len(remoteRows)-len(localRows))}
+    localFirst, localLast, localDups := local.span()
+    remoteFirst, remoteLast, remoteDups := remote.span()
+    out = append(out, fmt.Sprintf("Date range: %s..%s → %s..%s", dateText(localFirst), dateText(localLast), dateText(remoteFirst), dateText(remoteLast)))
+    out = append(out, fmt.Sprintf("Missing dates: %d → %d%s", len(local.missing()), len(remote.missing()), newDates(local.missing(), remote.missing())))
+    out = append(out, fmt.Sprintf("Duplicate dates: %d → %d%s", len(localDups), len(remoteDups), newDates(localDups, remoteDups)))
+
+    type pair struct{ local, remote int }
+    var shared []pair
+    for i, t := range local.dates {
+        if j, ok := remote.byDate[t]; ok && !t.IsZero() && local.byDate[t] == i {
+            shared = append(shared, pair{i, j})
+        }
+    }
+    sharedLocal, sharedRemote := map[int]bool{}, map[int]bool{}
+    for _, p := range shared {
+        sharedLocal[p.local], sharedRemote[p.remote] = true, true
+    }
+
+    var edited []time.Time
+    for i, name := range localCSV[0] {
+        j := headerIndex(remoteCSV[0], strings.TrimSpace(name))
+        if i == localCol || j < 0 || inferColumn(name, columnValues(localRows, i)).Type == "text" {
+            continue
+        }
+        a, b := statsOf(localRows, i, nil), statsOf(remoteRows, j, nil)
+        if a.count == 0 || b.count == 0 {
+            continue
+        }
+        if a == b {
+            out = append(out, fmt.Sprintf("%s: unchanged (min %.6g, max %.6g, mean %.6g, sum %.6g)", name, a.min, a.max, a.mean(), a.sum))
+        } else {
+            out = append(out, fmt.Sprintf("%s: min %.6g → %.6g, max %.6g → %.6g, mean %.6g → %.6g%s, sum %.6g → %.6g%s", name,
+                a.min, b.min, a.max, b.max, a.mean(), b.mean(), relChange(a.mean(), b.mean()), a.sum, b.sum, relChange(a.sum, b.sum)))
+        }
+
+        sa := statsOf(localRows, i, func(k int) bool { return sharedLocal[k] })
+        sb := statsOf(remoteRows, j, func(k int) bool { return sharedRemote[k] })
+        if sa.sum != sb.sum {
+            out = append(out, fmt.Sprintf("%s over %d shared dates: sum %.6g → %.6g%s", name, len(shared), sa.sum, sb.sum, relChange(sa.sum, sb.sum)))
+        }
+        for _, p := range shared {
+            if kind, _ := compareFields(field(localRows[p.local], i), field(remoteRows[p.remote], j), ToleranceConfig{}); kind == valueChanged {
+                edited = append(edited, local.dates[p.local])
+            }
+        }
+    }
+    if len(edited) > 0 {
+        sort.Slice(edited, func(i, j int) bool { return edited[i].Before(edited[j]) })
+        days := map[time.Time]bool{}
+        for _, t := range edited {
+            days[t] = true
+        }
+        out = append(out, fmt.Sprintf("Previously published dates with changed values: %d (earliest %s, latest %s)", len(days), dateText(edited[0]), dateText(edited[len(edited)-1])))
+    }
+    return out, nil
+}
+
+func columnValues(rows [][]string, col int) []string {
+    values := make([]string, len(rows))
+    for i, row := range rows {
+        values[i] = strings.TrimSpace(field(row, col))
+    }
+    return values
+}
+
+func dateText(t time.Time) string {
+    if t.IsZero() {
+        return "?"
+    }
+    if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+        return t.Format("2006-01-02")
+    }
+    return t.Format(time.RFC3339)
+}
+
+// newDates lists the dates in remote that are not in local.
+func newDates(local, remote []time.Time) string {
+    known := map[time.Time]bool{}
+    for _, t := range local {
+        known[t] = true
+    }
+    var parts []string
+    count := 0
+    for _, t := range remote {
+        if known[t] {
+            continue
+        }
+        if count++; count <= maxListedDates {
+            parts = append(parts, dateText(t))
+        }
+    }
+    if count == 0 {
+        return ""
+    }
+    if count > maxListedDates {
+        parts = append(parts, fmt.Sprintf("and %d more", count-maxListedDates))
+    }
+    return " (new: " + strings.Join(parts, ", ") + ")"
+}
+
+func relChange(a, b float64) string {
+    if a == 0 || a == b {
+        return ""
+    }
+    return fmt.Sprintf(" (%+.3g%%)", 100*(b-a)/math.Abs(a))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestSeriesSummary(t *testing.T) {
+    base := table("Date,Close,Note", "2020-12-01,10,a", "2020-12-02,20,b", "2020-12-03,30,c", "2020-12-04,40,d")
+    tests := []struct {
+        name   string
+        local  [][]string
+        remote [][]string
+        want   []string
+    }{
+        {"monotonic append", base, table("Date,Close,Note", "2020-12-01,10,a", "2020-12-02,20,b", "2020-12-03,30,c", "2020-12-04,40,d", "2020-12-05,50,e"), []string{
+            "Rows: 4 → 5 (+1)",
+            "Date range: 2020-12-01..2020-12-04 → 2020-12-01..2020-12-05",
+            "Missing dates: 0 → 0",
+            "Duplicate dates: 0 → 0",
+            "Close: min 10 → 10, max 40 → 50, mean 25 → 30 (+20%), sum 100 → 150 (+50%)",
+        }},
+        {"newest first", base, table("Date,Close,Note", "2020-12-05,50,e", "2020-12-04,40,d", "2020-12-03,30,c", "2020-12-02,20,b", "2020-12-01,10,a"), []string{
+            "Rows: 4 → 5 (+1)",
+            "Date range: 2020-12-01..2020-12-04 → 2020-12-01..2020-12-05",
+            "Missing dates: 0 → 0",
+            "Duplicate dates: 0 → 0",
+            "Close: min 10 → 10, max 40 → 50, mean 25 → 30 (+20%), sum 100 → 150 (+50%)",
+        }},
+        {"gap and duplicate", base, table("Date,Close,Note", "2020-12-01,10,a", "2020-12-02,20,b", "2020-12-04,40,d", "2020-12-05,50,e", "2020-12-05,50,e"), []string{
+            "Rows: 4 → 5 (+1)",
+            "Date range: 2020-12-01..2020-12-04 → 2020-12-01..2020-12-05",
+            "Missing dates: 0 → 1 (new: 2020-12-03)",
+            "Duplicate dates: 0 → 1 (new: 2020-12-05)",
+            "Close: min 10 → 10, max 40 → 50, mean 25 → 34 (+36%), sum 100 → 170 (+70%)",
+        }},
+        {"edited history", base, table("Date,Close,Note", "2020-12-01,10,a", "2020-12-02,25,b", "2020-12-03,30,c", "2020-12-04,40,d"), []string{
+            "Rows: 4 → 4 (+0)",
+            "Date range: 2020-12-01..2020-12-04 → 2020-12-01..2020-12-04",
+            "Missing dates: 0 → 0",
+            "Duplicate dates: 0 → 0",
+            "Close: min 10 → 10, max 40 → 40, mean 25 → 26.25 (+5%), sum 100 → 105 (+5%)",
+            "Close over 4 shared dates: sum 100 → 105 (+5%)",
+            "Previously published dates with changed values: 1 (earliest 2020-12-02, latest 2020-12-02)",
+        }},
+        {"unchanged values", base, base, []string{
+            "Rows: 4 → 4 (+0)",
+            "Date range: 2020-12-01..2020-12-04 → 2020-12-01..2020-12-04",
+            "Missing dates: 0 → 0",
+            "Duplicate dates: 0 → 0",
+            "Close: unchanged (min 10, max 40, mean 25, sum 100)",
+        }},
+        {"non-numeric values", table("Date,Note", "2020-12-01,a", "2020-12-02,b"), table("Date,Note", "2020-12-01,a", "2020-12-02,c"), []string{
+            "Rows: 2 → 2 (+0)",
+            "Date range: 2020-12-01..2020-12-02 → 2020-12-01..2020-12-02",
+            "Missing dates: 0 → 0",
+            "Duplicate dates: 0 → 0",
+        }},
+        {"non-date time column", table("Date,Close", "first,1", "second,2"), table("Date,Close", "first,1", "second,3"), []string{
+            "Rows: 2 → 2 (+0)",
+            "Date range: ?..? → ?..?",
+            "Missing dates: 0 → 0",
+            "Duplicate dates: 0 → 0",
+            "Close: min 1 → 1, max 2 → 3, mean 1.5 → 2 (+33.3%), sum 3 → 4 (+33.3%)",
+        }},
+    }
+    for _, tt := range tests {
+        got, err := seriesSummary(tt.local, tt.remote, "Date")
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+            t.Errorf("%s: summary\n  %s\nwant\n  %s", tt.name, strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+        }
+    }
+
+    if _, err := seriesSummary(base, table("Day,Close", "2020-12-01,10"), "Date"); err == nil {
+        t.Error("summarised a series without its time column")
+    }
+    if _, err := seriesSummary(nil, base, "Date"); err == nil {
+        t.Error("summarised a series without a header")
+    }
+}
+
+func TestSeriesFinding(t *testing.T) {
+    ws := &WatchSet{Diff: DiffConfig{CSV: CSVDiffConfig{Parse: "strict", Tables: []CSVTableConfig{
+        {Match: "series.csv", TimeColumn: "Date"},
+        {Match: "dated.csv", TimeColumn: "Day"},
+        {Match: "plain.csv", Key: []string{"Date"}},
+    }}}}
+    local := []byte("Date,Close\n2020-12-01,10\n2020-12-02,20\n")
+    remote := []byte("Date,Close\n2020-12-01,10\n2020-12-02,20\n2020-12-03,30\n")
+    tests := []struct {
+        filename string
+        want     string
+    }{
+        {"series.csv", "[ts] series.csv: Series summary (Date)\n  Rows: 2 → 3 (+1)\n  Date range: 2020-12-01..2020-12-02 → 2020-12-01..2020-12-03\n"},
+        {"dated.csv", "[ts] dated.csv: Series summary unavailable: no \"Day\" column\n"},
+        {"plain.csv", ""},
+        {"other.csv", ""},
+    }
+    for _, tt := range tests {
+        got := seriesFinding(ws, tt.filename, local, remote, "ts")
+        if !strings.HasPrefix(got, tt.want) || (tt.want == "") != (got == "") {
+            t.Errorf("%s: %q, want prefix %q", tt.filename, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+    "bufio"
+    "crypto/ed25519"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+)
+
+// Each line of a file output is one LogRecord. Hash is the SHA-256 of the
+// compact JSON encoding of the record with hash and signature left out, and
+// Prev is the Hash of the record before it (zeroHash for the first), so
+// editing, dropping or reordering any line breaks every link after it.
+// Truncation of the tail is caught by comparing against the head file
+// written next to the log (and against the head carried in signed receipts).
+
+type shiftEntry struct {
+    File string
+    Kind string
+    Text string
+}
+
+type LogRecord struct {
+    Seq       int64     `json:"seq"`
+    Time      time.Time `json:"time"`
+    WatchSet  string    `json:"watch_set"`
+    File      string    `json:"file,omitempty"`
+    Kind      string    `json:"kind"`
+    Text      string    `json:"text"`
+    Prev      string    `json:"prev"`
+    Hash      string    `json:"hash,omitempty"`
+    Signature string    `json:"signature,omitempty"`
+}
+
+type LogHead struct {
+    Seq  int64  `json:"seq"`
+    Hash string `json:"hash"`
+}
+
+func (r LogRecord) computeHash() (string, error) {
+    r.Hash = ""
+    r.Signature = ""
+    data, err := json.Marshal(r)
+    if err != nil {
+        return "", err
+    }
+    return sha256Hex(data), nil
+}
+
+func logHeadPath(path string) string {
+    return path + ".head"
+}
+
+func readLogRecords(path string) ([]LogRecord, []string, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil, nil
+        }
+        return nil, nil, err
+    }
+    defer f.Close()
+
+    var records []LogRecord
+    var problems []string
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    lineNo := 0
+    for scanner.Scan() {
+        lineNo++
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+        var rec LogRecord
+        if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+            problems = append(problems, fmt.Sprintf("line %d: not a log record: %v", lineNo, err))
+            continue
+        }
+        records = append(records, rec)
+    }
+    return records, problems, scanner.Err()
+}
+
+func appendChainedLog(path string, ws *WatchSet, entries []shiftEntry, sign bool) (*LogHead, error) {
+    records, problems, err := readLogRecords(path)
+    if err != nil {
+        return nil, err
+    }
+    if len(problems) > 0 {
+        return nil, fmt.Errorf("%s is not a valid chained log (%s); run verify-log", path, problems[0])
+    }
+
+    head := &LogHead{Hash: zeroHash}
+    if len(records) > 0 {
+        last := records[len(records)-1]
+        head = &LogHead{Seq: last.Seq, Hash: last.Hash}
+    }
+
+    var priv ed25519.PrivateKey
+    if sign {
+        if priv, err = loadPrivateKey(ws.SigningKey); err != nil {
+            return nil, fmt.Errorf("log signing key: %v", err)
+        }
+    }
+
+    logFileHandle, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return nil, err
+    }
+    defer logFileHandle.Close()
+
+    now := time.Now().UTC()
+    for _, entry := range entries {
+        rec := LogRecord{
+            Seq:      head.Seq + 1,
+            Time:     now,
+            WatchSet: ws.Name,
+            File:     entry.File,
+            Kind:     entry.Kind,
+            Text:     entry.Text,
+            Prev:     head.Hash,
+        }
+        if rec.Hash, err = rec.computeHash(); err != nil {
+            return nil, err
+        }
+        if priv != nil {
+            digest, _ := hex.DecodeString(rec.Hash)
+            rec.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest))
+        }
+
+        line, err := json.Marshal(rec)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := logFileHandle.Write(append(line, '\n')); err != nil {
+            return nil, err
+        }
+        head = &LogHead{Seq: rec.Seq, Hash: rec.Hash}
+    }
+
+    data, err := json.Marshal(head)
+    if err != nil {
+        return nil, err
+    }
+    return head, writeFileAtomic(logHeadPath(path), append(data, '\n'))
+}
+
+func verifyChainedLog(path string, pub ed25519.PublicKey, expected *LogHead) (*LogHead, []string, error) {
+    records, problems, err := readLogRecords(path)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    head := &LogHead{Hash: zeroHash}
+    for _, rec := range records {
+        if rec.Seq != head.Seq+1 {
+            problems = append(problems, fmt.Sprintf("seq %d: expected seq %d (records removed or reordered)", rec.Seq, head.Seq+1))
+        }
+        if rec.Prev != head.Hash {
+            problems = append(problems, fmt.Sprintf("seq %d: previous-hash link broken (an earlier record was edited, removed or reordered)", rec.Seq))
+        }
+        if h, err := rec.computeHash(); err != nil || h != rec.Hash {
+            problems = append(problems, fmt.Sprintf("seq %d: record content does not match its hash (edited)", rec.Seq))
+        }
+        if pub != nil {
+            digest, _ := hex.DecodeString(rec.Hash)
+            sig, err := base64.StdEncoding.DecodeString(rec.Signature)
+            if rec.Signature == "" {
+                problems = append(problems, fmt.Sprintf("seq %d: record is not signed", rec.Seq))
+            } else if err != nil || !ed25519.Verify(pub, digest, sig) {
+                problems = append(problems, fmt.Sprintf("seq %d: signature does not verify", rec.Seq))
+            }
+        }
+        head = &LogHead{Seq: rec.Seq, Hash: rec.Hash}
+    }
+
+    if expected == nil {
+        data, err := os.ReadFile(logHeadPath(path))
+        if err == nil {
+            var stored LogHead
+            if err := json.Unmarshal(data, &stored); err != nil {
+                problems = append(problems, fmt.Sprintf("head file %s is unreadable: %v", logHeadPath(path), err))
+            } else {
+                expected = &stored
+            }
+        } else if !os.IsNotExist(err) {
+            return nil, nil, err
+        }
+    }
+    if expected != nil {
+        if expected.Seq > head.Seq {
+            problems = append(problems, fmt.Sprintf("log truncated: expected head at seq %d, log ends at seq %d", expected.Seq, head.Seq))
+        } else {
+            found := expected.Seq == 0 && expected.Hash == zeroHash
+            for _, rec := range records {
+                if rec.Seq == expected.Seq && rec.Hash == expected.Hash {
+                    found = true
+                    break
+                }
+            }
+            if !found {
+                problems = append(problems, fmt.Sprintf("expected head seq %d hash %s is not in the log", expected.Seq, expected.Hash))
+            }
+        }
+    }
+    return head, problems, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+    "crypto/ed25519"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// testLog writes a signed chained log of four records over two appends and
+// returns its path, lines, the watch set that wrote it and the public key
+// that verifies it.
+func testLog(t *testing.T) (string, []string, *WatchSet, ed25519.PublicKey) {
+    t.Helper()
+    dir := t.TempDir()
+    ws := &WatchSet{Name: "default", SigningKey: filepath.Join(dir, "receipt.key")}
+    if err := generateKeyPair(ws.SigningKey, filepath.Join(dir, "receipt.pub")); err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(dir, "shifts.jsonl")
+    batches := [][]shiftEntry{
+        {{File: "bitcoin.csv", Kind: "shift", Text: "Diff for bitcoin.csv\n"}, {File: "time.csv", Kind: "tamper", Text: "Local tampering\n"}},
+        {{Kind: "rewrite", Text: "History rewritten\n"}, {File: "stars.csv", Kind: "added", Text: "Added upstream\n"}},
+    }
+    for _, entries := range batches {
+        if _, err := appendChainedLog(path, ws, entries, true); err != nil {
+            t.Fatal(err)
+        }
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pub, err := loadPublicKey(filepath.Join(dir, "receipt.pub"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return path, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), ws, pub
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+    t.Helper()
+    if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestChainedLogIntact(t *testing.T) {
+    path, lines, _, pub := testLog(t)
+    head, problems, err := verifyChainedLog(path, pub, nil)
+    if err != nil || len(problems) > 0 {
+        t.Fatalf("intact log: %v %v", err, problems)
+    }
+    if head.Seq != int64(len(lines)) {
+        t.Errorf("head at seq %d, want %d", head.Seq, len(lines))
+    }
+}
+
+func TestChainedLogEditedRecord(t *testing.T) {
+    edits := map[string]interface{}{
+        "seq":       7,
+        "time":      "2001-01-01T00:00:00Z",
+        "watch_set": "other",
+        "file":      "other.csv",
+        "kind":      "reverted",
+        "text":      "Nothing to see\n",
+        "prev":      sha256Hex([]byte("elsewhere")),
+        "hash":      zeroHash,
+        "signature": "AAAA",
+    }
+    for field, value := range edits {
+        for i := 0; i < 4; i++ {
+            path, lines, _, pub := testLog(t)
+            var rec map[string]interface{}
+            if err := json.Unmarshal([]byte(lines[i]), &rec); err != nil {
+                t.Fatal(err)
+            }
+            rec[field] = value
+            line, err := json.Marshal(rec)
+            if err != nil {
+                t.Fatal(err)
+            }
+            lines[i] = string(line)
+            writeLines(t, path, lines)
+
+            if _, problems, err := verifyChainedLog(path, pub, nil); err != nil || len(problems) == 0 {
+                t.Errorf("record %d with %s edited: verified (%v)", i+1, field, err)
+            }
+        }
+    }
+}
+
+func TestChainedLogTampering(t *testing.T) {
+    tests := []struct {
+        name   string
+        tamper func(t *testing.T, path string, lines []string)
+    }{
+        {"last record dropped", func(t *testing.T, path string, lines []string) {
+            writeLines(t, path, lines[:len(lines)-1])
+        }},
+        {"middle record dropped", func(t *testing.T, path string, lines []string) {
+            writeLines(t, path, append(append([]string(nil), lines[:1]...), lines[2:]...))
+        }},
+        {"records swapped", func(t *testing.T, path string, lines []string) {
+            lines[1], lines[2] = lines[2], lines[1]
+            writeLines(t, path, lines)
+        }},
+        {"record duplicated", func(t *testing.T, path string, lines []string) {
+            writeLines(t, path, append(lines, lines[len(lines)-1]))
+        }},
+        {"line mangled", func(t *testing.T, path string, lines []string) {
+            lines[2] = lines[2][:len(lines[2])/2]
+            writeLines(t, path, lines)
+        }},
+        {"head unreadable", func(t *testing.T, path string, lines []string) {
+            os.WriteFile(logHeadPath(path), []byte("{not json\n"), 0644)
+        }},
+        {"head hash changed", func(t *testing.T, path string, lines []string) {
+            os.WriteFile(logHeadPath(path), []byte(`{"seq":4,"hash":"`+zeroHash+`"}`+"\n"), 0644)
+        }},
+        {"head ahead of the log", func(t *testing.T, path string, lines []string) {
+            var rec LogRecord
+            json.Unmarshal([]byte(lines[3]), &rec)
+            os.WriteFile(logHeadPath(path), []byte(`{"seq":5,"hash":"`+rec.Hash+`"}`+"\n"), 0644)
+        }},
+    }
+    for _, tt := range tests {
+        path, lines, _, _ := testLog(t)
+        tt.tamper(t, path, lines)
+        if _, problems, err := verifyChainedLog(path, nil, nil); err != nil || len(problems) == 0 {
+            t.Errorf("%s: verified (%v)", tt.name, err)
+        }
+    }
+}
+
+func TestChainedLogExpectedHead(t *testing.T) {
+    path, lines, ws, _ := testLog(t)
+    var rec LogRecord
+    if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+        t.Fatal(err)
+    }
+    // A receipt carrying an earlier head still verifies against a longer log.
+    if _, problems, err := verifyChainedLog(path, nil, &LogHead{Seq: rec.Seq, Hash: rec.Hash}); err != nil || len(problems) > 0 {
+        t.Errorf("earlier head: %v %v", err, problems)
+    }
+    if _, problems, _ := verifyChainedLog(path, nil, &LogHead{Seq: rec.Seq, Hash: zeroHash}); len(problems) == 0 {
+        t.Error("head with a foreign hash verified")
+    }
+
+    // Appending to a log that no longer parses is refused.
+    lines[0] = "garbage"
+    writeLines(t, path, lines)
+    if _, err := appendChainedLog(path, ws, []shiftEntry{{Kind: "shift", Text: "x"}}, false); err == nil {
+        t.Error("appended to a corrupt log")
+    }
+}
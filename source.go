@@ -0,0 +1,306 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math/rand"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// A Source is where a watch set's remote copies come from. Fetch reports a
+// missing file as a 404 remoteFile rather than an error so every source is
+// treated the same way as an HTTP origin by the cycle.
+type Source interface {
+    String() string
+    Host() string
+    Location(filename string) string
+    Fetch(ctx context.Context, filename string) (*remoteFile, error)
+}
+
+// A Lister can enumerate the files a source currently holds, which lets a
+// cycle notice files added, deleted or renamed upstream.
+type Lister interface {
+    List(ctx context.Context) ([]string, error)
+}
+
+type remoteFile struct {
+    URL        string
+    StatusCode int
+    Header     http.Header
+    Commit     string
+    Body       []byte
+
+    // Revalidated is set when the body came from the object store after the
+    // server confirmed it was unchanged; StaleValidators when a download
+    // returned new content under the validators of the old content.
+    Revalidated     bool
+    StaleValidators bool
+}
+
+func (ws *WatchSet) source() Source {
+    return newSource(ws, ws.Source, ws.requestProfile())
+}
+
+func newSource(ws *WatchSet, c SourceConfig, profile *ProfileConfig) Source {
+    switch c.Type {
+    case "dir":
+        return &dirSource{path: c.Path, maxSize: ws.Fetch.MaxSize}
+    case "git":
+        return &gitSource{repo: c.Path, ref: c.Ref, origin: c.URL, localDir: ws.Dir, maxSize: ws.Fetch.MaxSize}
+    }
+    client := &http.Client{
+        Timeout: time.Duration(ws.Fetch.Timeout),
+    }
+    return &httpSource{base: c.URL, listing: c.Listing, profile: profile, client: client, maxSize: ws.Fetch.MaxSize}
+}
+
+// listSource returns the sorted names the source holds that the watch set
+// tracks, or nil when the source cannot be listed.
+func listSource(ctx context.Context, ws *WatchSet, source Source) ([]string, error) {
+    lister, ok := source.(Lister)
+    if !ok {
+        return nil, nil
+    }
+    names, err := lister.List(ctx)
+    if err != nil || names == nil {
+        return nil, err
+    }
+
+    listed := []string{}
+    for _, name := range names {
+        if !strings.Contains(name, "/") && ws.matches(name) {
+            listed = append(listed, name)
+        }
+    }
+    sort.Strings(listed)
+    return listed, nil
+}
+
+func hasName(sorted []string, name string) bool {
+    i := sort.SearchStrings(sorted, name)
+    return i < len(sorted) && sorted[i] == name
+}
+
+// untrackedNames returns the listed names that are not in tracked.
+func untrackedNames(tracked, listed []string) []string {
+    var added []string
+    for _, name := range listed {
+        if !hasName(tracked, name) {
+            added = append(added, name)
+        }
+    }
+    return added
+}
+
+type httpSource struct {
+    base    string
+    listing string
+    profile *ProfileConfig
+    cheap   *cheapCheck
+    client  *http.Client
+    maxSize int64
+}
+
+func (s *httpSource) String() string {
+    return s.base
+}
+
+func (s *httpSource) Host() string {
+    return urlHost(s.base)
+}
+
+func (s *httpSource) Location(filename string) string {
+    return s.base + url.PathEscape(filename)
+}
+
+func randomTimestamp() string {
+    return strconv.FormatInt(time.Now().UnixNano(), 16) + "-" + strconv.Itoa(rand.Intn(1000000))
+}
+
+func (s *httpSource) Fetch(ctx context.Context, filename string) (*remoteFile, error) {
+    if meta := s.cheap.revalidatable(filename); meta != nil {
+        remote, err := s.revalidate(ctx, filename, meta)
+        if remote != nil || err != nil {
+            return remote, err
+        }
+    }
+
+    sourceURL := s.Location(filename)
+    rawURL := sourceURL + "?t=" + randomTimestamp()
+
+    req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    s.profile.apply(req)
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    remote := &remoteFile{URL: sourceURL, StatusCode: resp.StatusCode, Header: resp.Header}
+    if resp.StatusCode != http.StatusOK {
+        return remote, nil
+    }
+
+    remote.Body, err = s.readBody(resp)
+    if err != nil {
+        return nil, err
+    }
+    remote.StaleValidators = s.cheap.record(filename, resp.Header, remote.Body)
+    return remote, nil
+}
+
+func (s *httpSource) readBody(resp *http.Response) ([]byte, error) {
+    if resp.ContentLength > s.maxSize {
+        return nil, &tooLargeError{Size: resp.ContentLength, Limit: s.maxSize}
+    }
+    body, err := io.ReadAll(io.LimitReader(resp.Body, s.maxSize+1))
+    if err != nil {
+        return nil, fmt.Errorf("read failed: %w", err)
+    }
+    if s.profile.AcceptEncoding != "" {
+        body, err = decodeBody(resp.Header.Get("Content-Encoding"), body)
+        if err != nil {
+            return nil, fmt.Errorf("decode failed: %v", err)
+        }
+    }
+    if int64(len(body)) > s.maxSize {
+        return nil, &tooLargeError{Size: int64(len(body)), Limit: s.maxSize}
+    }
+    return body, nil
+}
+
+// List reads the configured listing URL, which may be a JSON array of names,
+// a JSON array of objects with a name or path field (as directory APIs
+// return), or plain text with one name per line.
+func (s *httpSource) List(ctx context.Context) ([]string, error) {
+    if s.listing == "" {
+        return nil, nil
+    }
+    base, err := url.Parse(s.base)
+    if err != nil {
+        return nil, err
+    }
+    ref, err := url.Parse(s.listing)
+    if err != nil {
+        return nil, err
+    }
+    listingURL := base.ResolveReference(ref).String()
+
+    req, err := http.NewRequestWithContext(ctx, "GET", listingURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    s.profile.apply(req)
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("listing %s: HTTP %d", listingURL, resp.StatusCode)
+    }
+    data, err := io.ReadAll(resp.Body)
+    if err == nil && s.profile.AcceptEncoding != "" {
+        data, err = decodeBody(resp.Header.Get("Content-Encoding"), data)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("listing %s: read failed: %v", listingURL, err)
+    }
+    return parseListing(data), nil
+}
+
+func parseListing(data []byte) []string {
+    var names []string
+    if err := json.Unmarshal(data, &names); err == nil {
+        return names
+    }
+    var entries []struct {
+        Name string `json:"name"`
+        Path string `json:"path"`
+        Type string `json:"type"`
+    }
+    if err := json.Unmarshal(data, &entries); err == nil {
+        names = []string{}
+        for _, e := range entries {
+            if e.Type != "" && e.Type != "file" && e.Type != "blob" {
+                continue
+            }
+            if e.Name != "" {
+                names = append(names, e.Name)
+            } else if e.Path != "" {
+                names = append(names, e.Path)
+            }
+        }
+        return names
+    }
+
+    names = []string{}
+    for _, line := range strings.Split(string(data), "\n") {
+        if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+            names = append(names, line)
+        }
+    }
+    return names
+}
+
+type dirSource struct {
+    path    string
+    maxSize int64
+}
+
+func (s *dirSource) String() string {
+    return s.path
+}
+
+func (s *dirSource) Host() string {
+    return "dir:" + s.path
+}
+
+func (s *dirSource) Location(filename string) string {
+    return filepath.Join(s.path, filepath.FromSlash(filename))
+}
+
+func (s *dirSource) List(ctx context.Context) ([]string, error) {
+    entries, err := os.ReadDir(s.path)
+    if err != nil {
+        return nil, err
+    }
+    names := []string{}
+    for _, entry := range entries {
+        if entry.Type().IsRegular() {
+            names = append(names, entry.Name())
+        }
+    }
+    return names, nil
+}
+
+func (s *dirSource) Fetch(ctx context.Context, filename string) (*remoteFile, error) {
+    path := s.Location(filename)
+    remote := &remoteFile{URL: path, StatusCode: http.StatusOK}
+    if fi, err := os.Stat(path); err == nil && fi.Size() > s.maxSize {
+        return nil, &tooLargeError{Size: fi.Size(), Limit: s.maxSize}
+    }
+    body, err := os.ReadFile(path)
+    if err != nil {
+        if os.IsNotExist(err) {
+            remote.StatusCode = http.StatusNotFound
+            return remote, nil
+        }
+        return nil, err
+    }
+    remote.Body = body
+    return remote, nil
+}
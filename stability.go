@@ -0,0 +1,160 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+const stabilityFile = "stability.json"
+
+// fileState follows one file's remote content across cycles. Candidate is a
+// hash that differs from the baseline and has been seen for Count
+// consecutive cycles; it is only reported as a shift once Count reaches the
+// configured number of confirmations, and only once. Tampered is the local
+// hash (or failure) the last tamper alert was logged for.
+type fileState struct {
+    Last        string      `json:"last,omitempty"`
+    Candidate   string      `json:"candidate,omitempty"`
+    Count       int         `json:"count,omitempty"`
+    Since       time.Time   `json:"since,omitempty"`
+    Confirmed   bool        `json:"confirmed,omitempty"`
+    Transitions []time.Time `json:"transitions,omitempty"`
+    Flapping    bool        `json:"flapping,omitempty"`
+    Tampered    string      `json:"tampered,omitempty"`
+}
+
+type stabilityTracker struct {
+    cfg   StabilityConfig
+    now   time.Time
+    files map[string]*fileState
+}
+
+func stabilityPath(ws *WatchSet) string {
+    return filepath.Join(ws.StateDir, stabilityFile)
+}
+
+func loadStability(ws *WatchSet) (*stabilityTracker, error) {
+    t := &stabilityTracker{cfg: ws.Stability, now: time.Now().UTC(), files: map[string]*fileState{}}
+    data, err := os.ReadFile(stabilityPath(ws))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return t, nil
+        }
+        return nil, err
+    }
+    if err := json.Unmarshal(data, &t.files); err != nil {
+        return nil, fmt.Errorf("%s: %v", stabilityPath(ws), err)
+    }
+    return t, nil
+}
+
+func (t *stabilityTracker) state(filename string) *fileState {
+    st := t.files[filename]
+    if st == nil {
+        st = &fileState{}
+        t.files[filename] = st
+    }
+    return st
+}
+
+// confirmed reports whether hash is filename's candidate and was already
+// confirmed, i.e. its shift has been alerted on in an earlier cycle.
+func (t *stabilityTracker) confirmed(filename, hash string) bool {
+    st := t.files[filename]
+    return st != nil && st.Candidate == hash && st.Confirmed
+}
+
+// added records hash as the confirmed candidate of a file listed upstream
+// but not tracked yet, and reports whether it is a version not seen before.
+func (t *stabilityTracker) added(filename, hash string) bool {
+    if t.confirmed(filename, hash) {
+        return false
+    }
+    st := t.state(filename)
+    st.Last, st.Candidate, st.Count, st.Since, st.Confirmed = hash, hash, 1, t.now, true
+    return true
+}
+
+// tampered records the local state a tamper alert is about and reports
+// whether it differs from the one already alerted on. An empty local marks
+// the file as matching its baseline again.
+func (t *stabilityTracker) tampered(filename, local string) bool {
+    st := t.files[filename]
+    if st == nil && local == "" {
+        return false
+    }
+    st = t.state(filename)
+    if st.Tampered == local {
+        return false
+    }
+    st.Tampered = local
+    return local != ""
+}
+
+func (t *stabilityTracker) save(ws *WatchSet) error {
+    data, err := json.MarshalIndent(t.files, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(stabilityPath(ws), append(data, '\n'))
+}
+
+// observe records that filename served hash this cycle. settled means the
+// hash needs no alert (it is the baseline or a rejected version). It returns
+// how many consecutive cycles an unsettled hash has now been seen, plus
+// entries for transient shifts that were abandoned and for flapping.
+// describe renders a stored object as a diff against the baseline.
+func (t *stabilityTracker) observe(filename, hash string, settled bool, ts string, describe func(object string) string) (int, []shiftEntry) {
+    st := t.state(filename)
+
+    var entries []shiftEntry
+    if st.Last != "" && st.Last != hash {
+        st.Transitions = append(st.Transitions, t.now)
+    }
+    st.Last = hash
+    cutoff := t.now.Add(-time.Duration(t.cfg.FlapWindow))
+    for len(st.Transitions) > 0 && st.Transitions[0].Before(cutoff) {
+        st.Transitions = st.Transitions[1:]
+    }
+    if t.cfg.FlapThreshold > 0 && len(st.Transitions) >= t.cfg.FlapThreshold {
+        if !st.Flapping {
+            text := fmt.Sprintf("[%s] %s: Flapping - remote content changed %d times within %s\n", ts, filename, len(st.Transitions), time.Duration(t.cfg.FlapWindow))
+            entries = append(entries, shiftEntry{File: filename, Kind: "flapping", Text: text})
+        }
+        st.Flapping = true
+    } else {
+        st.Flapping = false
+    }
+
+    if settled {
+        if st.Candidate != "" && st.Candidate != hash {
+            entries = append(entries, t.abandoned(filename, st, "reverted to the baseline", ts, describe))
+        }
+        st.Candidate, st.Count, st.Confirmed = "", 0, false
+        return 0, entries
+    }
+
+    if hash != st.Candidate {
+        if st.Candidate != "" && !st.Confirmed {
+            entries = append(entries, t.abandoned(filename, st, "changed again to "+hash, ts, describe))
+        }
+        st.Candidate, st.Count, st.Since, st.Confirmed = hash, 0, t.now, false
+    }
+    st.Count++
+    if st.Count >= t.cfg.Confirmations {
+        st.Confirmed = true
+    }
+    return st.Count, entries
+}
+
+func (t *stabilityTracker) abandoned(filename string, st *fileState, outcome, ts string, describe func(string) string) shiftEntry {
+    if st.Confirmed {
+        text := fmt.Sprintf("[%s] %s: Reverted - remote no longer serves confirmed shift %s (first seen %s), %s\n", ts, filename, st.Candidate, st.Since.Local().Format(time.RFC3339), outcome)
+        return shiftEntry{File: filename, Kind: "reverted", Text: text}
+    }
+    text := fmt.Sprintf("[%s] %s: Transient shift - remote served %s for %d of %d required cycles (first seen %s), then %s\n", ts, filename, st.Candidate, st.Count, t.cfg.Confirmations, st.Since.Local().Format(time.RFC3339), outcome)
+    return shiftEntry{File: filename, Kind: "transient", Text: text + describe(st.Candidate)}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestStabilityAlertsOnce(t *testing.T) {
+    tracker := &stabilityTracker{cfg: StabilityConfig{Confirmations: 2}, now: time.Now().UTC(), files: map[string]*fileState{}}
+    describe := func(string) string { return "" }
+
+    // Each step is one cycle serving hash; alert is whether runCycle logs it.
+    steps := []struct {
+        hash, baseline string
+        alert          bool
+    }{
+        {"base", "base", false},
+        {"a", "base", false}, // seen 1 of 2
+        {"a", "base", true},  // confirmed
+        {"a", "base", false}, // still unaccepted
+        {"a", "base", false},
+        {"b", "base", false}, // changed again, seen 1 of 2
+        {"b", "base", true},
+        {"b", "b", false}, // accepted
+        {"a", "b", false},
+        {"a", "b", true},
+    }
+    for i, step := range steps {
+        alerted := tracker.confirmed("f.csv", step.hash)
+        seen, _ := tracker.observe("f.csv", step.hash, step.hash == step.baseline, "", describe)
+        alert := step.hash != step.baseline && !alerted && seen >= tracker.cfg.Confirmations
+        if alert != step.alert {
+            t.Errorf("cycle %d (%s): alert %v, want %v", i+1, step.hash, alert, step.alert)
+        }
+    }
+}
+
+func TestStabilityAddedAndTampered(t *testing.T) {
+    tracker := &stabilityTracker{cfg: StabilityConfig{Confirmations: 1}, now: time.Now().UTC(), files: map[string]*fileState{}}
+
+    added := []struct {
+        hash string
+        want bool
+    }{{"a", true}, {"a", false}, {"b", true}, {"b", false}}
+    for i, step := range added {
+        if got := tracker.added("new.csv", step.hash); got != step.want {
+            t.Errorf("added cycle %d (%s): %v, want %v", i+1, step.hash, got, step.want)
+        }
+    }
+
+    tampered := []struct {
+        local string
+        want  bool
+    }{{"", false}, {"x", true}, {"x", false}, {"missing", true}, {"", false}, {"x", true}}
+    for i, step := range tampered {
+        if got := tracker.tampered("f.csv", step.local); got != step.want {
+            t.Errorf("tampered cycle %d (%q): %v, want %v", i+1, step.local, got, step.want)
+        }
+    }
+    if _, ok := tracker.files["g.csv"]; ok || tracker.tampered("g.csv", "") {
+        t.Error("intact file without state gained an alert or state")
+    }
+}
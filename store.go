@@ -0,0 +1,116 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+const indexFile = "index.jsonl"
+
+type objectStore struct {
+    dir string
+}
+
+type IndexEntry struct {
+    Cycle  string    `json:"cycle"`
+    Time   time.Time `json:"time"`
+    File   string    `json:"file"`
+    Object string    `json:"object,omitempty"`
+    Commit string    `json:"commit,omitempty"`
+    Status string    `json:"status"`
+}
+
+func openStore(ws *WatchSet) *objectStore {
+    return &objectStore{dir: filepath.Join(ws.StateDir, "objects")}
+}
+
+func (s *objectStore) path(hash string) string {
+    if len(hash) < 3 {
+        return filepath.Join(s.dir, hash)
+    }
+    return filepath.Join(s.dir, hash[:2], hash[2:])
+}
+
+func (s *objectStore) has(hash string) bool {
+    _, err := os.Stat(s.path(hash))
+    return err == nil
+}
+
+func (s *objectStore) put(data []byte) (string, error) {
+    hash := sha256Hex(data)
+    if s.has(hash) {
+        return hash, nil
+    }
+    if err := writeFileAtomic(s.path(hash), data); err != nil {
+        return "", err
+    }
+    return hash, nil
+}
+
+func (s *objectStore) get(hash string) ([]byte, error) {
+    data, err := os.ReadFile(s.path(hash))
+    if err != nil {
+        return nil, err
+    }
+    if got := sha256Hex(data); got != hash {
+        return nil, fmt.Errorf("object %s is corrupt (content hashes to %s)", hash, got)
+    }
+    return data, nil
+}
+
+func indexPath(ws *WatchSet) string {
+    return filepath.Join(ws.StateDir, indexFile)
+}
+
+func appendIndex(ws *WatchSet, entries []IndexEntry) error {
+    if err := os.MkdirAll(ws.StateDir, 0755); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(indexPath(ws), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    for _, entry := range entries {
+        line, err := json.Marshal(entry)
+        if err != nil {
+            return err
+        }
+        if _, err := f.Write(append(line, '\n')); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func readIndex(ws *WatchSet) ([]IndexEntry, error) {
+    f, err := os.Open(indexPath(ws))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    defer f.Close()
+
+    var entries []IndexEntry
+    scanner := bufio.NewScanner(f)
+    lineNo := 0
+    for scanner.Scan() {
+        lineNo++
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+        var entry IndexEntry
+        if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+            return nil, fmt.Errorf("%s line %d: %v", indexPath(ws), lineNo, err)
+        }
+        entries = append(entries, entry)
+    }
+    return entries, scanner.Err()
+}